@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/conductorone/baton-wiz/pkg/connector"
+	"github.com/conductorone/baton-wiz/pkg/syncdiff"
+	"github.com/spf13/cobra"
+)
+
+// newDiffCommand returns the command comparing two c1z files produced by the connector, so access drift between
+// two syncs can be reviewed without loading them into ConductorOne.
+func newDiffCommand() *cobra.Command {
+	var (
+		output             string
+		internalDomains    []string
+		accessTaxonomyFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "diff <old.c1z> <new.c1z>",
+		Short: "Compare two syncs and report added and removed resources, principals and grants",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			classifier, err := connector.NewPrivilegeClassifier(accessTaxonomyFile)
+			if err != nil {
+				return err
+			}
+			old, err := syncdiff.Load(ctx, args[0], classifier)
+			if err != nil {
+				return err
+			}
+			current, err := syncdiff.Load(ctx, args[1], classifier)
+			if err != nil {
+				return err
+			}
+
+			d := syncdiff.Compare(old, current, syncdiff.Options{InternalDomains: internalDomains})
+			return d.Write(cmd.OutOrStdout(), output)
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", syncdiff.FormatText, "Output format: text, json or csv")
+	cmd.Flags().StringSliceVar(&internalDomains, "internal-domains", nil,
+		"Email domains of the organization, principals with an email in another domain are highlighted as external")
+	cmd.Flags().StringVar(&accessTaxonomyFile, "access-taxonomy-file", "",
+		"Path to the JSON access level rules the syncs were run with, used to tell admin grants of entitlements not marked with --mark-sensitive-entitlements")
+
+	return cmd
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+
+	"github.com/conductorone/baton-sdk/pkg/field"
+	"github.com/conductorone/baton-wiz/pkg/client"
+	"github.com/conductorone/baton-wiz/pkg/connector"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// newExplainCommand returns the command showing what a sync with the connector flags would cover. It only lists
+// resources, it reads no effective access and writes no c1z.
+func newExplainCommand(v *viper.Viper, schema field.Configuration) *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:     "explain",
+		Aliases: []string{"dry-run"},
+		Short:   "List the resources the configured selectors match and estimate the API calls of a sync, without syncing",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "text" && output != "json" {
+				return fmt.Errorf("wiz-connector: invalid output format %q, must be text or json", output)
+			}
+
+			ctx, config, err := commandConfig(cmd, v, schema)
+			if err != nil {
+				return err
+			}
+			c, err := connector.New(ctx, config)
+			if err != nil {
+				return err
+			}
+			explanation, err := c.Explain(ctx)
+			if err != nil {
+				return err
+			}
+
+			if output == "json" {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(explanation)
+			}
+			return writeExplanation(cmd.OutOrStdout(), explanation)
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format: text or json")
+
+	return cmd
+}
+
+func writeExplanation(w io.Writer, explanation *connector.Explanation) error {
+	var err error
+	printf := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	for i, te := range explanation.Tenants {
+		if i != 0 {
+			printf("\n")
+		}
+		if te.Tenant != "" {
+			printf("Tenant %s\n", te.Tenant)
+		}
+		printf("%d resources matched\n", te.Resources)
+		for _, counts := range []struct {
+			title  string
+			counts map[string]int
+		}{
+			{"By type", te.ByType},
+			{"By cloud account", te.ByCloudAccount},
+			{"By project", te.ByProject},
+		} {
+			printf("\n%s:\n", counts.title)
+			for _, k := range byCount(counts.counts) {
+				printf("  %8d  %s\n", counts.counts[k], k)
+			}
+		}
+
+		printf("\nSample resources:\n")
+		for _, name := range te.Samples {
+			printf("  %s\n", name)
+		}
+
+		printf("\nQueries:\n")
+		for _, q := range te.Queries {
+			printf("  %s\n", scopeQueryTitle(q))
+			variables, jsonErr := json.MarshalIndent(q.Variables, "    ", "  ")
+			if jsonErr != nil {
+				return jsonErr
+			}
+			printf("    %s\n", variables)
+		}
+
+		printf("\nEstimated effective access calls: at least %d (%d resources, one call per granted entity type %v their scope reads, plus a call per extra page of %d entries)\n",
+			te.EffectiveAccessCalls, te.Resources, te.GrantedEntityTypes, client.DefaultPageSize)
+	}
+	return err
+}
+
+func scopeQueryTitle(q *client.ScopeQuery) string {
+	scope := "flags"
+	if q.Scope != "" {
+		scope = "scope " + q.Scope
+	}
+	title := fmt.Sprintf("%s, project %s: %s", scope, q.ProjectID, q.Operation)
+	if q.Principals != 0 {
+		title += fmt.Sprintf(", one query for each of %d principals", q.Principals)
+	}
+	return title
+}
+
+// byCount returns the keys by decreasing count, then by name.
+func byCount(counts map[string]int) []string {
+	return slices.SortedFunc(maps.Keys(counts), func(a string, b string) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+	})
+}
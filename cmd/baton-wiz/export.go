@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/conductorone/baton-sdk/pkg/field"
+	"github.com/conductorone/baton-wiz/pkg/accessexport"
+	"github.com/conductorone/baton-wiz/pkg/connector"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// newExportCommand returns the command flattening effective access into CSV or JSON Lines, from a c1z file or
+// straight from the Wiz API with the connector's configuration flags.
+func newExportCommand(v *viper.Viper, schema field.Configuration) *cobra.Command {
+	var (
+		fromC1Z string
+		format  string
+		output  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export effective access as one row per resource, principal and permission",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var out io.Writer = cmd.OutOrStdout()
+			if output != "" && output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return fmt.Errorf("wiz-connector: error creating %s: %w", output, err)
+				}
+				defer f.Close()
+				out = f
+			}
+			w, err := accessexport.NewWriter(out, format)
+			if err != nil {
+				return err
+			}
+
+			if fromC1Z != "" {
+				err = accessexport.FromC1Z(cmd.Context(), fromC1Z, w)
+			} else {
+				err = exportFromAPI(cmd, v, schema, w)
+			}
+			if err != nil {
+				return err
+			}
+			return w.Close()
+		},
+	}
+	cmd.Flags().StringVar(&fromC1Z, "from-c1z", "", "Export the latest sync of this c1z file instead of reading the Wiz API")
+	cmd.Flags().StringVar(&format, "format", accessexport.FormatCSV, "Export format: csv or jsonl")
+	cmd.Flags().StringVarP(&output, "output", "o", "-", "File to write the export to, - for stdout")
+
+	return cmd
+}
+
+// exportFromAPI reads effective access from Wiz with the configured selectors, like a sync would.
+func exportFromAPI(cmd *cobra.Command, v *viper.Viper, schema field.Configuration, w accessexport.Writer) error {
+	ctx, config, err := commandConfig(cmd, v, schema)
+	if err != nil {
+		return err
+	}
+	config.Export = true
+	c, err := connector.New(ctx, config)
+	if err != nil {
+		return err
+	}
+	return accessexport.FromConnector(ctx, c, w)
+}
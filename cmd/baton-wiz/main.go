@@ -4,13 +4,18 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/cli"
 	"github.com/conductorone/baton-sdk/pkg/config"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
 	"github.com/conductorone/baton-sdk/pkg/field"
+	"github.com/conductorone/baton-sdk/pkg/logging"
 	"github.com/conductorone/baton-sdk/pkg/types"
 	"github.com/conductorone/baton-wiz/pkg/connector"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
@@ -20,11 +25,12 @@ var version = "dev"
 func main() {
 	ctx := context.Background()
 
-	_, cmd, err := config.DefineConfiguration(
+	schema := field.NewConfiguration(configurationFields, configRelations...)
+	v, cmd, err := config.DefineConfiguration(
 		ctx,
 		"baton-wiz",
 		getConnector,
-		field.NewConfiguration(configurationFields, configRelations...),
+		schema,
 	)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
@@ -32,6 +38,17 @@ func main() {
 	}
 
 	cmd.Version = version
+	cmd.AddCommand(newDiffCommand())
+	// The export and explain commands take the connector flags, and check their relationships once they need to
+	// read the Wiz API.
+	connectorFlags := field.NewConfiguration(configurationFields)
+	for _, sub := range []*cobra.Command{newExportCommand(v, schema), newExplainCommand(v, schema)} {
+		_, err = cli.AddCommand(cmd, v, &connectorFlags, sub)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
 
 	err = cmd.Execute()
 	if err != nil {
@@ -43,6 +60,45 @@ func main() {
 func getConnector(ctx context.Context, v *viper.Viper) (types.ConnectorServer, error) {
 	l := ctxzap.Extract(ctx)
 
+	cb, err := connector.New(ctx, connectorConfig(v))
+	if err != nil {
+		l.Error("wiz-connector: error creating connector", zap.Error(err))
+		return nil, err
+	}
+	connector, err := connectorbuilder.NewConnector(ctx, cb)
+	if err != nil {
+		l.Error("wiz-connector: error creating connector", zap.Error(err))
+		return nil, err
+	}
+	return &reportingConnector{ConnectorServer: connector, connector: cb}, nil
+}
+
+// commandConfig reads the connector configuration for a subcommand taking the connector flags, once the flags are
+// validated and logging is set up like for a sync.
+func commandConfig(cmd *cobra.Command, v *viper.Viper, schema field.Configuration) (context.Context, *connector.Config, error) {
+	err := v.BindPFlags(cmd.Flags())
+	if err != nil {
+		return nil, nil, err
+	}
+	err = field.Validate(schema, v)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, err := logging.Init(
+		cmd.Context(),
+		logging.WithLogFormat(v.GetString("log-format")),
+		logging.WithLogLevel(v.GetString("log-level")),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ctx, connectorConfig(v), nil
+}
+
+// connectorConfig returns the connector configuration from the configuration flags.
+func connectorConfig(v *viper.Viper) *connector.Config {
 	clientID := v.GetString(clientIDField.FieldName)
 	clientSecret := v.GetString(clientSecretField.FieldName)
 	endpointURL := v.GetString(endpointURL.FieldName)
@@ -55,29 +111,115 @@ func getConnector(ctx context.Context, v *viper.Viper) (types.ConnectorServer, e
 	syncServiceUsers := v.GetBool(syncServiceUsers.FieldName)
 	externalSyncMode := v.GetBool(externalSyncMode.FieldName)
 	projectID := v.GetString(projectID.FieldName)
-
-	cb, err := connector.New(ctx, &connector.Config{
-		ClientID:            clientID,
-		ClientSecret:        clientSecret,
-		EndpointURL:         endpointURL,
-		AuthURL:             authURL,
-		Audience:            audience,
-		ResourceIDs:         resourceIDs,
-		ResourceTags:        resourceTags,
-		ResourceTypes:       resourceTypes,
-		SyncIdentities:      syncIdentities,
-		SyncServiceAccounts: syncServiceUsers,
-		ExternalSyncMode:    externalSyncMode,
-		ProjectID:           projectID,
-	})
-	if err != nil {
-		l.Error("wiz-connector: error creating connector", zap.Error(err))
-		return nil, err
+	identityStrategies := v.GetStringSlice(identityStrategies.FieldName)
+	identityMappingFile := v.GetString(identityMappingFile.FieldName)
+	correlateIdentities := v.GetBool(correlateIdentities.FieldName)
+	includeAccessPaths := v.GetBool(includeAccessPaths.FieldName)
+	syncRoles := v.GetBool(syncRoles.FieldName)
+	normalizeAccessLevels := v.GetBool(normalizeAccessLevels.FieldName)
+	accessTaxonomyFile := v.GetString(accessTaxonomyFile.FieldName)
+	markSensitiveEntitlements := v.GetBool(markSensitiveEntitlements.FieldName)
+	enrichSecurityContext := v.GetBool(enrichSecurityContext.FieldName)
+	syncIssues := v.GetBool(syncIssues.FieldName)
+	principalEmails := v.GetStringSlice(principalEmails.FieldName)
+	principalGroupIDs := v.GetStringSlice(principalGroupIDs.FieldName)
+	principalIdentityProviders := v.GetStringSlice(principalIdentityProviders.FieldName)
+	cloudProviders := v.GetStringSlice(cloudProviders.FieldName)
+	cloudAccountIDs := v.GetStringSlice(cloudAccountIDs.FieldName)
+	cloudRegions := v.GetStringSlice(cloudRegions.FieldName)
+	excludeResourceIDs := v.GetStringSlice(excludeResourceIDs.FieldName)
+	excludeResourceNames := v.GetStringSlice(excludeResourceNames.FieldName)
+	excludeResourceTags := v.GetString(excludeResourceTags.FieldName)
+	excludePrincipalIDs := v.GetStringSlice(excludePrincipalIDs.FieldName)
+	excludePrincipalNames := v.GetStringSlice(excludePrincipalNames.FieldName)
+	excludeNativeTypes := v.GetStringSlice(excludeNativeTypes.FieldName)
+	excludeCloudProviders := v.GetStringSlice(excludeCloudProviders.FieldName)
+	clientSecretFile := v.GetString(clientSecretFile.FieldName)
+	clientSecretCommand := v.GetString(clientSecretCommand.FieldName)
+	region := v.GetString(region.FieldName)
+	environment := v.GetString(environment.FieldName)
+	authProvider := v.GetString(authProvider.FieldName)
+	proxyURL := v.GetString(proxyURL.FieldName)
+	caCertFiles := v.GetStringSlice(caCertFiles.FieldName)
+	tlsClientCertFile := v.GetString(tlsClientCertFile.FieldName)
+	tlsClientKeyFile := v.GetString(tlsClientKeyFile.FieldName)
+	tlsMinVersion := v.GetString(tlsMinVersion.FieldName)
+	syncReportFile := v.GetString(syncReportFile.FieldName)
+	configFile := v.GetString(configFile.FieldName)
+	configScope := v.GetString(configScope.FieldName)
+	incrementalSync := v.GetBool(incrementalSync.FieldName)
+	incrementalStateFile := v.GetString(incrementalStateFile.FieldName)
+	fullSyncInterval := time.Duration(v.GetInt(fullSyncIntervalHours.FieldName)) * time.Hour
+	// Incremental syncs carry data over from the previous sync of the c1z file being synced.
+	previousSyncFile := v.GetString("file")
+	if incrementalStateFile == "" && previousSyncFile != "" {
+		incrementalStateFile = previousSyncFile + ".incremental.json"
 	}
-	connector, err := connectorbuilder.NewConnector(ctx, cb)
-	if err != nil {
-		l.Error("wiz-connector: error creating connector", zap.Error(err))
-		return nil, err
+
+	return &connector.Config{
+		ClientID:                     clientID,
+		ClientSecret:                 clientSecret,
+		ClientSecretFile:             clientSecretFile,
+		ClientSecretCommand:          clientSecretCommand,
+		EndpointURL:                  endpointURL,
+		AuthURL:                      authURL,
+		Audience:                     audience,
+		Region:                       region,
+		Environment:                  environment,
+		AuthProvider:                 authProvider,
+		ProxyURL:                     proxyURL,
+		CACertFiles:                  caCertFiles,
+		TLSClientCertFile:            tlsClientCertFile,
+		TLSClientKeyFile:             tlsClientKeyFile,
+		TLSMinVersion:                tlsMinVersion,
+		ResourceIDs:                  resourceIDs,
+		ResourceTags:                 resourceTags,
+		ResourceTypes:                resourceTypes,
+		SyncIdentities:               syncIdentities,
+		SyncServiceAccounts:          syncServiceUsers,
+		ExternalSyncMode:             externalSyncMode,
+		ProjectID:                    projectID,
+		IdentityStrategies:           identityStrategies,
+		IdentityMappingFile:          identityMappingFile,
+		CorrelateIdentities:          correlateIdentities,
+		IncludeAccessPaths:           includeAccessPaths,
+		SyncRoles:                    syncRoles,
+		NormalizeAccessLevels:        normalizeAccessLevels,
+		AccessTaxonomyFile:           accessTaxonomyFile,
+		MarkSensitiveEntitlements:    markSensitiveEntitlements,
+		EnrichSecurityContext:        enrichSecurityContext,
+		SyncIssues:                   syncIssues,
+		PrincipalEmails:              principalEmails,
+		PrincipalGroupIDs:            principalGroupIDs,
+		PrincipalIdentityProviders:   principalIdentityProviders,
+		CloudProviders:               cloudProviders,
+		CloudAccountIDs:              cloudAccountIDs,
+		CloudRegions:                 cloudRegions,
+		ExcludeResourceIDs:           excludeResourceIDs,
+		ExcludeResourceNamePatterns:  excludeResourceNames,
+		ExcludeResourceTags:          excludeResourceTags,
+		ExcludePrincipalIDs:          excludePrincipalIDs,
+		ExcludePrincipalNamePatterns: excludePrincipalNames,
+		ExcludeNativeTypes:           excludeNativeTypes,
+		ExcludeCloudProviders:        excludeCloudProviders,
+		ConfigFile:                   configFile,
+		ConfigScope:                  configScope,
+		SyncReportFile:               syncReportFile,
+		IncrementalSync:              incrementalSync,
+		IncrementalStateFile:         incrementalStateFile,
+		PreviousSyncFile:             previousSyncFile,
+		FullSyncInterval:             fullSyncInterval,
 	}
-	return connector, nil
+}
+
+// reportingConnector writes the sync report and the incremental sync state when the syncer cleans up after a
+// completed sync.
+type reportingConnector struct {
+	types.ConnectorServer
+	connector *connector.Connector
+}
+
+func (r *reportingConnector) Cleanup(ctx context.Context, request *v2.ConnectorServiceCleanupRequest) (*v2.ConnectorServiceCleanupResponse, error) {
+	r.connector.FinishSync(ctx)
+	return r.ConnectorServer.Cleanup(ctx, request)
 }
@@ -0,0 +1,153 @@
+package accessexport
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/dotc1z"
+	"github.com/conductorone/baton-wiz/pkg/connector"
+)
+
+// FromConnector writes a row per permission of every effective access entry read from the Wiz API, with the
+// configured selectors, exclusions and identity strategies.
+func FromConnector(ctx context.Context, c *connector.Connector, w Writer) error {
+	return c.EffectiveAccess(ctx, func(access *connector.ResourceAccess) error {
+		for _, p := range access.Permissions {
+			err := w.Write(&Row{
+				ResourceID:    access.ResourceID,
+				Resource:      access.ResourceName,
+				ResourceType:  access.Resource.Type,
+				CloudPlatform: access.Resource.Properties.CloudPlatform,
+				CloudAccount:  access.Resource.Properties.SubscriptionExternalId,
+				PrincipalID:   access.PrincipalID,
+				Principal:     access.Principal.Name,
+				PrincipalType: principalType(access.Principal.Type),
+				Permission:    p,
+				AccessPath:    access.AccessPath,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// c1zResource is what rows need from a synced resource or principal.
+type c1zResource struct {
+	name          string
+	entityType    string
+	cloudPlatform string
+	cloudAccount  string
+}
+
+// FromC1Z writes a row per permission of every grant on a Wiz resource in the latest finished sync of a c1z file.
+// Grants are streamed page by page; only resources and principals are held in memory, to name them.
+func FromC1Z(ctx context.Context, path string, w Writer) error {
+	// dotc1z creates missing files, a typo in the path would otherwise export an empty sync.
+	_, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("wiz-connector: error opening %s: %w", path, err)
+	}
+
+	f, err := dotc1z.NewC1ZFile(ctx, path)
+	if err != nil {
+		return fmt.Errorf("wiz-connector: error opening %s: %w", path, err)
+	}
+	defer f.Close()
+
+	resources := make(map[string]*c1zResource)
+	pageToken := ""
+	for {
+		resp, err := f.ListResources(ctx, &v2.ResourcesServiceListResourcesRequest{PageToken: pageToken})
+		if err != nil {
+			return fmt.Errorf("wiz-connector: error listing resources of %s: %w", path, err)
+		}
+		for _, r := range resp.GetList() {
+			resources[resourceKey(r.GetId())] = newC1ZResource(r)
+		}
+		pageToken = resp.GetNextPageToken()
+		if pageToken == "" {
+			break
+		}
+	}
+
+	for {
+		resp, err := f.ListGrants(ctx, &v2.GrantsServiceListGrantsRequest{PageToken: pageToken})
+		if err != nil {
+			return fmt.Errorf("wiz-connector: error listing grants of %s: %w", path, err)
+		}
+		for _, g := range resp.GetList() {
+			err = writeGrant(w, g, resources)
+			if err != nil {
+				return err
+			}
+		}
+		pageToken = resp.GetNextPageToken()
+		if pageToken == "" {
+			break
+		}
+	}
+
+	return nil
+}
+
+func newC1ZResource(r *v2.Resource) *c1zResource {
+	res := &c1zResource{name: r.GetDisplayName()}
+	res.entityType, res.cloudPlatform, res.cloudAccount = connector.ResourceEntity(r)
+	return res
+}
+
+func writeGrant(w Writer, g *v2.Grant, resources map[string]*c1zResource) error {
+	resourceID := g.GetEntitlement().GetResource().GetId()
+	if !connector.IsWizResource(resourceID) {
+		return nil
+	}
+	resource, ok := resources[resourceKey(resourceID)]
+	if !ok {
+		resource = &c1zResource{name: resourceID.GetResource()}
+	}
+	principalID := g.GetPrincipal().GetId()
+	// In external sync mode, principals are matched to another connector's resources and are not in the file.
+	principal, ok := resources[resourceKey(principalID)]
+	if !ok {
+		principal = &c1zResource{name: principalID.GetResource()}
+	}
+
+	// Normalized entitlements list the raw permissions behind the access level in the grant metadata.
+	var permissions []string
+	var accessPath string
+	if md, ok := connector.GetGrantAccessMetadata(g); ok {
+		permissions = md.Permissions
+		accessPath = md.AccessPathSummary
+	}
+	if len(permissions) == 0 {
+		permissions = []string{strings.TrimPrefix(g.GetEntitlement().GetId(), resourceKey(resourceID)+":")}
+	}
+
+	for _, p := range permissions {
+		err := w.Write(&Row{
+			ResourceID:    resourceID.GetResource(),
+			Resource:      resource.name,
+			ResourceType:  resource.entityType,
+			CloudPlatform: resource.cloudPlatform,
+			CloudAccount:  resource.cloudAccount,
+			PrincipalID:   principalID.GetResource(),
+			Principal:     principal.name,
+			PrincipalType: principalType(principal.entityType),
+			Permission:    p,
+			AccessPath:    accessPath,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resourceKey(id *v2.ResourceId) string {
+	return id.GetResourceType() + ":" + id.GetResource()
+}
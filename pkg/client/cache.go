@@ -0,0 +1,191 @@
+package client
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// effectiveAccessCache holds the effective access pages fetched during a sync on disk, one file per resource page, so
+// that users, entitlements and grants reading the same page share a single fetch. The syncer lists every resource
+// before any entitlement and every entitlement before any grant, so a cache bounded in memory would have evicted a
+// page by the time the next phase reads it, while the disk holds the pages of every resource for the whole sync. A
+// miss, including a page that cannot be read back, is refetched like any other page.
+type effectiveAccessCache struct {
+	mu      sync.Mutex
+	enabled bool
+	// dir is created with the first page of a sync and removed by clear.
+	dir string
+}
+
+type effectiveAccessPageKey struct {
+	resourceID        string
+	grantedEntityType string
+	cursor            string
+}
+
+// fileName names the page's file after a digest of its key, resource IDs and cursors are not valid file names.
+func (k effectiveAccessPageKey) fileName() string {
+	sum := sha256.Sum256([]byte(k.resourceID + "\x00" + k.grantedEntityType + "\x00" + k.cursor))
+	return hex.EncodeToString(sum[:]) + ".json"
+}
+
+// newEffectiveAccessCache returns a cache of effective access pages, a disabled cache stores nothing.
+func newEffectiveAccessCache(enabled bool) *effectiveAccessCache {
+	return &effectiveAccessCache{enabled: enabled}
+}
+
+// get returns the page stored for the key.
+func (ec *effectiveAccessCache) get(key effectiveAccessPageKey) (*ResourcePermissions, bool) {
+	ec.mu.Lock()
+	dir := ec.dir
+	ec.mu.Unlock()
+	if dir == "" {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, key.fileName()))
+	if err != nil {
+		return nil, false
+	}
+	res := &ResourcePermissions{}
+	err = json.Unmarshal(data, res)
+	if err != nil {
+		return nil, false
+	}
+	return res, true
+}
+
+// put stores a freshly fetched page. The page is written to a temporary file and renamed, so that a concurrent get
+// never reads a partial page.
+func (ec *effectiveAccessCache) put(key effectiveAccessPageKey, res *ResourcePermissions) error {
+	if !ec.enabled {
+		return nil
+	}
+	dir, err := ec.directory()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "page-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(dir, key.fileName()))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+func (ec *effectiveAccessCache) directory() (string, error) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	if ec.dir == "" {
+		dir, err := os.MkdirTemp("", "baton-wiz-effective-access-")
+		if err != nil {
+			return "", err
+		}
+		ec.dir = dir
+	}
+	return ec.dir, nil
+}
+
+// clear removes every stored page.
+func (ec *effectiveAccessCache) clear() error {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	if ec.dir == "" {
+		return nil
+	}
+	err := os.RemoveAll(ec.dir)
+	ec.dir = ""
+	return err
+}
+
+// lruCache is a bounded cache: the least recently used entry is evicted once it is full.
+type lruCache[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[K]*list.Element
+}
+
+type lruCacheEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// newLRUCache returns a cache of capacity entries, a capacity of zero caches nothing.
+func newLRUCache[K comparable, V any](capacity int) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[K]*list.Element),
+	}
+}
+
+// get returns the cached value and marks it as the most recently used.
+func (lc *lruCache[K, V]) get(key K) (V, bool) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	el, ok := lc.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	lc.order.MoveToFront(el)
+	return el.Value.(*lruCacheEntry[K, V]).value, true
+}
+
+// put stores a freshly fetched value, evicting the least recently used entries beyond the capacity.
+func (lc *lruCache[K, V]) put(key K, value V) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	if lc.capacity <= 0 {
+		return
+	}
+	if el, ok := lc.entries[key]; ok {
+		el.Value.(*lruCacheEntry[K, V]).value = value
+		lc.order.MoveToFront(el)
+		return
+	}
+
+	lc.entries[key] = lc.order.PushFront(&lruCacheEntry[K, V]{key: key, value: value})
+	for lc.order.Len() > lc.capacity {
+		oldest := lc.order.Back()
+		lc.order.Remove(oldest)
+		delete(lc.entries, oldest.Value.(*lruCacheEntry[K, V]).key)
+	}
+}
+
+// ClearEffectiveAccessCache removes the effective access pages cached during a sync, so that a later sync in the same
+// process reads effective access afresh.
+func (c *Client) ClearEffectiveAccessCache() error {
+	err := c.effectiveAccessCache.clear()
+	if err != nil {
+		return fmt.Errorf("wiz-connector: error clearing the effective access cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+)
+
+// effectiveAccessHandler answers effective access queries with two pages per resource, counting the queries.
+func effectiveAccessHandler(calls *atomic.Int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables struct {
+				After    string `json:"after"`
+				FilterBy struct {
+					GrantedEntityType struct {
+						Equals string `json:"equals"`
+					} `json:"grantedEntityType"`
+					Resource struct {
+						ID struct {
+							Equals []string `json:"equals"`
+						} `json:"id"`
+					} `json:"resource"`
+				} `json:"filterBy"`
+			} `json:"variables"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil || len(body.Variables.FilterBy.Resource.ID.Equals) != 1 {
+			http.Error(w, "unexpected query", http.StatusBadRequest)
+			return
+		}
+		calls.Add(1)
+
+		resourceID := body.Variables.FilterBy.Resource.ID.Equals[0]
+		res := &ResourcePermissions{}
+		entries := &res.Data.EntityEffectiveAccessEntries
+		entries.Nodes = []EffectiveAccessEntry{{
+			GrantedEntity: &GrantedEntity{Id: resourceID + "-user" + body.Variables.After, Type: body.Variables.FilterBy.GrantedEntityType.Equals},
+			Permissions:   []string{"s3:GetObject"},
+		}}
+		if body.Variables.After == "" {
+			entries.PageInfo = PageInfo{HasNextPage: true, EndCursor: "1"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	}
+}
+
+// readEffectiveAccess walks every effective access page of the resource and returns the number of entries read.
+func readEffectiveAccess(t *testing.T, c *Client, resourceID string) int {
+	t.Helper()
+	entries := 0
+	token := &pagination.Token{}
+	for {
+		page, next, err := c.ListResourceEffectiveAccess(context.Background(), resourceID, token)
+		if err != nil {
+			t.Fatalf("ListResourceEffectiveAccess(%q) error = %v", resourceID, err)
+		}
+		entries += len(page.Data.EntityEffectiveAccessEntries.Nodes)
+		if next == "" {
+			return entries
+		}
+		token = &pagination.Token{Token: next}
+	}
+}
+
+func TestEffectiveAccessCacheSync(t *testing.T) {
+	// More resources than pages an in-memory cache would hold, so that pages must survive from one phase to the next.
+	const resources = 300
+	resourceIDs := make([]string, 0, resources)
+	for i := range resources {
+		resourceIDs = append(resourceIDs, fmt.Sprintf("r%d", i))
+	}
+	calls := &atomic.Int64{}
+	c := newTestClient(t, []*Scope{{ResourceIDs: resourceIDs}}, false, effectiveAccessHandler(calls))
+
+	// Users are listed with the resources, then entitlements and grants read each resource in turn.
+	users := 0
+	token := &pagination.Token{}
+	for {
+		page, next, err := c.ListUsersWithAccessToResources(context.Background(), token)
+		if err != nil {
+			t.Fatalf("ListUsersWithAccessToResources() error = %v", err)
+		}
+		users += len(page.Data.EntityEffectiveAccessEntries.Nodes)
+		if next == "" {
+			break
+		}
+		token = &pagination.Token{Token: next}
+	}
+	if users != 2*resources {
+		t.Errorf("listed %d users, want %d", users, 2*resources)
+	}
+	for _, phase := range []string{"entitlements", "grants"} {
+		for _, id := range resourceIDs {
+			if got := readEffectiveAccess(t, c, id); got != 2 {
+				t.Fatalf("%s read %d entries of %s, want 2", phase, got, id)
+			}
+		}
+	}
+	if got := calls.Load(); got != 2*resources {
+		t.Errorf("a sync made %d effective access calls, want one per page: %d", got, 2*resources)
+	}
+
+	err := c.ClearEffectiveAccessCache()
+	if err != nil {
+		t.Fatalf("ClearEffectiveAccessCache() error = %v", err)
+	}
+	readEffectiveAccess(t, c, resourceIDs[0])
+	if got := calls.Load(); got != 2*resources+2 {
+		t.Errorf("effective access calls after clearing the cache = %d, want the resource read again: %d", got, 2*resources+2)
+	}
+}
+
+func TestEffectiveAccessCacheExport(t *testing.T) {
+	calls := &atomic.Int64{}
+	c := newTestClient(t, []*Scope{{ResourceIDs: []string{"r1"}}}, true, effectiveAccessHandler(calls))
+	readEffectiveAccess(t, c, "r1")
+	readEffectiveAccess(t, c, "r1")
+	if got := calls.Load(); got != 4 {
+		t.Errorf("an export made %d effective access calls, want every page read without caching: 4", got)
+	}
+}
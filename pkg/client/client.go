@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	"github.com/conductorone/baton-sdk/pkg/uhttp"
@@ -18,25 +21,10 @@ import (
 
 const ListUsersResourceTypeResourceID = "resourceID"
 const ListUsersResourceTypeResourceTag = "resourceTag"
+const ListResourcesScope = "scope"
 
-const userQuery = `query CloudEntitlementsTable($after: String, $first: Int, $filterBy: EntityEffectiveAccessFilters) {
-  entityEffectiveAccessEntries(after: $after, first: $first, filterBy: $filterBy) {
-    nodes {
-       grantedEntity {
-        id
-        name
-        type
-        properties
-      }
-    }
-    pageInfo {
-      hasNextPage
-      endCursor
-    }
-  }
-}`
-
-const resourceQuery = `query GraphSearch($query: GraphEntityQueryInput, $projectId: String!, $first: Int, $after: String) {
+// resourceQueryTemplate is completed with any optional entity fields, see buildResourceQuery.
+const resourceQueryTemplate = `query GraphSearch($query: GraphEntityQueryInput, $projectId: String!, $first: Int, $after: String) {
   graphSearch(
     query: $query
     projectId: $projectId
@@ -47,7 +35,7 @@ const resourceQuery = `query GraphSearch($query: GraphEntityQueryInput, $project
       entities {
         id
         name
-        type
+        type%s
       }
     }
     pageInfo {
@@ -57,19 +45,13 @@ const resourceQuery = `query GraphSearch($query: GraphEntityQueryInput, $project
   }
 }`
 
-const resourcePermissionQuery = `query CloudEntitlementsTable($after: String, $first: Int, $filterBy: EntityEffectiveAccessFilters) {
-  entityEffectiveAccessEntries(after: $after, first: $first, filterBy: $filterBy) {
-    nodes {
-      permissions
-    }
-    pageInfo {
-      hasNextPage
-      endCursor
-    }
-  }
-}`
+// resourcePropertiesFields requests the entity properties, which carry Wiz's public exposure flag, the resource's
+// cloud account and the fields exclusion rules match.
+const resourcePropertiesFields = `
+        properties`
 
-const resourceEffectiveAccessQuery = `query CloudEntitlementsTable($after: String, $first: Int, $filterBy: EntityEffectiveAccessFilters) {
+// resourceEffectiveAccessQueryTemplate is completed with any optional node fields, see buildEffectiveAccessQuery.
+const resourceEffectiveAccessQueryTemplate = `query CloudEntitlementsTable($after: String, $first: Int, $filterBy: EntityEffectiveAccessFilters) {
   entityEffectiveAccessEntries(after: $after, first: $first, filterBy: $filterBy) {
     nodes {
       grantedEntity {
@@ -79,7 +61,7 @@ const resourceEffectiveAccessQuery = `query CloudEntitlementsTable($after: Strin
         properties
         providerUniqueId
       }
-      permissions
+      permissions%s
     }
     pageInfo {
       hasNextPage
@@ -88,6 +70,39 @@ const resourceEffectiveAccessQuery = `query CloudEntitlementsTable($after: Strin
   }
 }`
 
+// accessPathFields requests the entities access flows through between the granted entity and the resource: groups,
+// roles, assumed role chains, policies and resource policies.
+const accessPathFields = `
+      accessPath {
+        id
+        name
+        type
+        properties
+      }`
+
+// accessTypesFields requests Wiz's classification of the access, such as admin or high privilege.
+const accessTypesFields = `
+      accessTypes`
+
+func buildResourceQuery(includeProperties bool) string {
+	var fields string
+	if includeProperties {
+		fields += resourcePropertiesFields
+	}
+	return fmt.Sprintf(resourceQueryTemplate, fields)
+}
+
+func buildEffectiveAccessQuery(includeAccessPaths bool, includeAccessTypes bool) string {
+	var fields string
+	if includeAccessPaths {
+		fields += accessPathFields
+	}
+	if includeAccessTypes {
+		fields += accessTypesFields
+	}
+	return fmt.Sprintf(resourceEffectiveAccessQueryTemplate, fields)
+}
+
 const DefaultPageSize = 500
 
 const GrantedEntityTypeIdentity = "IDENTITY"
@@ -95,11 +110,17 @@ const GrantedEntityTypeUserAccount = "USER_ACCOUNT"
 const GrantedEntityTypeServiceAccount = "SERVICE_ACCOUNT"
 const GrantedEntityTypeGroup = "GROUP"
 
+const AccessPathEntityTypeAccessRole = "ACCESS_ROLE"
+const AccessPathEntityTypeAccessRoleBinding = "ACCESS_ROLE_BINDING"
+const AccessPathEntityTypeRawAccessPolicy = "RAW_ACCESS_POLICY"
+
 var grantedEntityTypeUserAccountFilter = []string{GrantedEntityTypeUserAccount}
 
 type GrantedEntityTypeToken struct {
 	GrantedEntityType string `json:"granted_entity_type"`
 	Token             string `json:"token"`
+	// Depth is the number of pages walked to reach the token.
+	Depth int `json:"depth,omitempty"`
 }
 
 func (gt *GrantedEntityTypeToken) Marshal() (string, error) {
@@ -110,35 +131,69 @@ func (gt *GrantedEntityTypeToken) Marshal() (string, error) {
 	return string(data), nil
 }
 
+// grantedEntityTypes returns the granted entity types effective access is read for when syncing the types given on
+// top of user accounts, which are always synced, and groups, which are synced in external sync mode.
+func grantedEntityTypes(synced []string, externalSyncMode bool) []string {
+	rv := slices.Clone(grantedEntityTypeUserAccountFilter)
+	for _, gt := range []string{GrantedEntityTypeServiceAccount, GrantedEntityTypeIdentity} {
+		if slices.Contains(synced, gt) {
+			rv = append(rv, gt)
+		}
+	}
+	if externalSyncMode {
+		rv = append(rv, GrantedEntityTypeGroup)
+	}
+	return rv
+}
+
 type Client struct {
 	baseHttpClient          *uhttp.BaseHttpClient
 	BearerToken             string
 	BaseUrl                 *url.URL
-	resourceIDs             []string
-	resourceTags            []*ResourceTag
-	resourceTypes           []string
+	clientID                string
+	credentials             CredentialSource
+	endpoints               *Endpoints
+	tokenExpiry             time.Time
+	tokenMtx                sync.Mutex
+	apiCalls                *apiCalls
+	scopes                  []*Scope
 	grantedEntityTypeFilter []string
 	resourceIdSet           mapset.Set[string]
-	projectId               string
+	roleResourceIdSet       mapset.Set[string]
+	effectiveAccessCache    *effectiveAccessCache
+	linkedAccountsCache     *lruCache[string, []*GrantedEntity]
+	effectiveAccessQuery    string
+	resourceQuery           string
+	// principalIDs limit effective access to the selected principals when every scope starts from principals. They
+	// are matched once entries are fetched, since they can be too many to send with every request.
+	principalIDs mapset.Set[string]
+	exclusions   *exclusions
+	// resourceScopes records the scope that listed each resource when there are several scopes.
+	resourceScopes    map[string]*Scope
+	resourceScopesMtx sync.Mutex
+	// incremental is set when only resources changed since the previous sync have their effective access read.
+	incremental *incremental
 }
 
 func New(
 	ctx context.Context,
 	clientId string,
-	clientSecret string,
-	audience string,
-	authUrl string,
-	endpointUrlPath string,
-	resourceIDs []string,
-	resourceTags []*ResourceTag,
-	resourceTypes []string,
+	credentials CredentialSource,
+	endpoints *Endpoints,
+	transport *TransportOptions,
+	scopes []*Scope,
 	syncIdentities bool,
 	syncServiceAccounts bool,
 	externalSyncMode bool,
-	projectId string,
+	includeAccessPaths bool,
+	syncRoles bool,
+	includeSensitivity bool,
+	includeSecurityContext bool,
+	export bool,
+	exclusionRules *ExclusionRules,
 ) (*Client, error) {
 	l := ctxzap.Extract(ctx)
-	httpClient, err := uhttp.NewClient(ctx, uhttp.WithLogger(true, l))
+	httpClient, err := newHTTPClient(ctx, transport)
 	if err != nil {
 		l.Error("wiz-connector: failed to create http client", zap.Error(err))
 		return nil, err
@@ -149,38 +204,93 @@ func New(
 		return nil, err
 	}
 
-	endpointUrl, err := url.Parse(endpointUrlPath)
+	err = endpoints.Resolve()
 	if err != nil {
 		return nil, err
 	}
 
-	grantedEntityTypeFilter := grantedEntityTypeUserAccountFilter
+	var syncedTypes []string
 	if syncServiceAccounts {
-		grantedEntityTypeFilter = append(grantedEntityTypeFilter, GrantedEntityTypeServiceAccount)
+		syncedTypes = append(syncedTypes, GrantedEntityTypeServiceAccount)
 	}
 	if syncIdentities {
-		grantedEntityTypeFilter = append(grantedEntityTypeFilter, GrantedEntityTypeIdentity)
+		syncedTypes = append(syncedTypes, GrantedEntityTypeIdentity)
 	}
-	if externalSyncMode {
-		grantedEntityTypeFilter = append(grantedEntityTypeFilter, GrantedEntityTypeGroup)
+	defaultGrantedEntityTypes := grantedEntityTypes(syncedTypes, externalSyncMode)
+
+	exclusions, err := newExclusions(exclusionRules)
+	if err != nil {
+		return nil, err
 	}
 
-	if projectId == "" {
-		projectId = "*"
+	// Scopes are copied so that clients of different tenants resolve their own principals.
+	clientScopes := make([]*Scope, 0, len(scopes))
+	var grantedEntityTypeFilter []string
+	needsResourceProperties := exclusions.needsResourceProperties()
+	for _, scope := range scopes {
+		s := *scope
+		if s.ProjectID == "" {
+			s.ProjectID = "*"
+		}
+		s.grantedEntityTypeFilter = defaultGrantedEntityTypes
+		if len(s.GrantedEntityTypes) != 0 {
+			s.grantedEntityTypeFilter = grantedEntityTypes(s.GrantedEntityTypes, externalSyncMode)
+		}
+		s.exclusions = exclusions
+		if s.Exclusions != nil {
+			s.exclusions, err = exclusions.withRules(s.Exclusions)
+			if err != nil {
+				return nil, err
+			}
+			needsResourceProperties = needsResourceProperties || s.exclusions.needsResourceProperties()
+		}
+		for _, gt := range s.grantedEntityTypeFilter {
+			if !slices.Contains(grantedEntityTypeFilter, gt) {
+				grantedEntityTypeFilter = append(grantedEntityTypeFilter, gt)
+			}
+		}
+		clientScopes = append(clientScopes, &s)
+	}
+	if len(clientScopes) == 0 {
+		grantedEntityTypeFilter = defaultGrantedEntityTypes
 	}
 
+	// Exports read effective access outside of a sync. Each page is read once, so none is cached; resources carry
+	// their properties, so exports can name their cloud account; and entries carry their access path.
+
 	client := Client{
 		baseHttpClient:          wrapper,
-		BaseUrl:                 endpointUrl,
-		resourceIDs:             resourceIDs,
-		resourceTags:            resourceTags,
-		resourceTypes:           resourceTypes,
+		clientID:                clientId,
+		credentials:             credentials,
+		endpoints:               endpoints,
+		scopes:                  clientScopes,
+		apiCalls:                &apiCalls{byOperation: make(map[string]int)},
 		grantedEntityTypeFilter: grantedEntityTypeFilter,
+		resourceScopes:          make(map[string]*Scope),
 		resourceIdSet:           mapset.NewSet[string](),
-		projectId:               projectId,
+		roleResourceIdSet:       mapset.NewSet[string](),
+		effectiveAccessCache:    newEffectiveAccessCache(!export),
+		linkedAccountsCache:     newLRUCache[string, []*GrantedEntity](linkedAccountsCacheSize),
+		effectiveAccessQuery:    buildEffectiveAccessQuery(includeAccessPaths || syncRoles || export, includeSensitivity),
+		resourceQuery:           buildResourceQuery(includeSecurityContext || export || needsResourceProperties),
+		exclusions:              exclusions,
 	}
 
-	err = client.Authorize(ctx, authUrl, clientId, clientSecret, audience)
+	err = client.Reauthorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = endpoints.resolveFromToken(client.BearerToken)
+	if err != nil {
+		return nil, err
+	}
+	client.BaseUrl, err = url.Parse(endpoints.EndpointURL)
+	if err != nil {
+		return nil, fmt.Errorf("wiz-connector: error parsing endpoint url: %w", err)
+	}
+
+	err = client.resolveScopePrincipals(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -194,7 +304,10 @@ func (c *Client) Authorize(
 	clientId string,
 	clientSecret string,
 	audience string,
-) error {
+) (err error) {
+	ctx, op := c.startOperation(ctx, tokenOperation, nil)
+	defer func() { c.endOperation(ctx, op, err) }()
+
 	form := &url.Values{}
 	form.Set("audience", audience)
 	form.Set("client_id", clientId)
@@ -215,6 +328,7 @@ func (c *Client) Authorize(
 	resp, err := c.baseHttpClient.Do(
 		request,
 		uhttp.WithJSONResponse(&at),
+		op.responseOption(),
 	)
 	if err != nil {
 		return fmt.Errorf("wiz-connector: error authorizing: %w", err)
@@ -222,13 +336,27 @@ func (c *Client) Authorize(
 	defer resp.Body.Close()
 
 	c.BearerToken = at.AccessToken
+	c.tokenExpiry = time.Time{}
+	if at.ExpiresIn > 0 {
+		c.tokenExpiry = time.Now().Add(time.Duration(at.ExpiresIn) * time.Second)
+	}
 
 	return nil
 }
 
-func (c *Client) ListUsersWithAccessToResources(ctx context.Context, pToken *pagination.Token) (*UsersWithAccessQueryResponse, string, error) {
+func (c *Client) ListUsersWithAccessToResources(ctx context.Context, pToken *pagination.Token) (*ResourcePermissions, string, error) {
+	return c.listEffectiveAccessForResources(ctx, pToken, c.resourceIdSet)
+}
+
+// ListAccessPathsForResources walks the same effective access entries as ListUsersWithAccessToResources so that
+// roles and policies can be discovered from their access paths. It keeps its own set of visited resources.
+func (c *Client) ListAccessPathsForResources(ctx context.Context, pToken *pagination.Token) (*ResourcePermissions, string, error) {
+	return c.listEffectiveAccessForResources(ctx, pToken, c.roleResourceIdSet)
+}
+
+func (c *Client) listEffectiveAccessForResources(ctx context.Context, pToken *pagination.Token, resourceIdSet mapset.Set[string]) (*ResourcePermissions, string, error) {
 	l := ctxzap.Extract(ctx)
-	bag, page, err := c.parseUserPageToken(pToken.Token, c.resourceIDs)
+	bag, page, err := c.parseUserPageToken(pToken.Token, c.seedResourceIDs())
 	if err != nil {
 		return nil, "", fmt.Errorf("wiz-connector: error parsing user page token: %w", err)
 	}
@@ -254,12 +382,12 @@ func (c *Client) ListUsersWithAccessToResources(ctx context.Context, pToken *pag
 
 		for _, n := range resources.Data.GraphSearch.Nodes {
 			for _, accessibleResource := range n.Entities {
-				if c.resourceIdSet.ContainsOne(accessibleResource.Id) {
+				if resourceIdSet.ContainsOne(accessibleResource.Id) || c.Unchanged(accessibleResource.Id) {
 					continue
 				}
-				c.resourceIdSet.Add(accessibleResource.Id)
+				resourceIdSet.Add(accessibleResource.Id)
 
-				for _, gt := range c.grantedEntityTypeFilter {
+				for _, gt := range c.resourceGrantedEntityTypes(accessibleResource.Id) {
 					userTypeWithToken := &GrantedEntityTypeToken{
 						GrantedEntityType: gt,
 					}
@@ -280,49 +408,14 @@ func (c *Client) ListUsersWithAccessToResources(ctx context.Context, pToken *pag
 		if err != nil {
 			return nil, "", err
 		}
-		return &UsersWithAccessQueryResponse{}, resourceNextPageMarshal, nil
+		return &ResourcePermissions{}, resourceNextPageMarshal, nil
 	case ListUsersResourceTypeResourceID:
 		ut, err := parseGrantedEntityTypeToken(page)
 		if err != nil {
 			return nil, "", fmt.Errorf("wiz-connector: error parsing user type page token: %w, page: %s", err, page)
 		}
 
-		variables := map[string]interface{}{
-			"first": DefaultPageSize,
-			"after": ut.Token,
-			"filterBy": map[string]interface{}{
-				"grantedEntityType": map[string]interface{}{
-					"equals": ut.GrantedEntityType,
-				},
-				"resource": map[string]interface{}{
-					"id": map[string]interface{}{
-						"equals": bag.ResourceID(),
-					},
-				},
-			},
-		}
-
-		payload := map[string]interface{}{
-			"query":     userQuery,
-			"variables": variables,
-		}
-
-		options := []uhttp.RequestOption{
-			uhttp.WithAcceptJSONHeader(),
-			uhttp.WithJSONBody(payload),
-			WithBearerToken(c.BearerToken),
-		}
-
-		req, err := c.baseHttpClient.NewRequest(ctx, http.MethodPost, c.BaseUrl, options...)
-		if err != nil {
-			return nil, "", err
-		}
-
-		res := &UsersWithAccessQueryResponse{}
-		resp, err := c.baseHttpClient.Do(
-			req,
-			uhttp.WithJSONResponse(&res),
-		)
+		res, err := c.getEffectiveAccessPage(withPageDepth(ctx, ut.Depth), bag.ResourceID(), ut)
 		if err != nil {
 			l.Error("wiz-connector: failed to list users with access to resources",
 				zap.String("page_token", pToken.Token),
@@ -332,11 +425,12 @@ func (c *Client) ListUsersWithAccessToResources(ctx context.Context, pToken *pag
 				zap.Error(err))
 			return nil, "", fmt.Errorf("wiz-connector: failed to list users with access to resources: %w", err)
 		}
-		defer resp.Body.Close()
+		res.Scope = c.resourceScopeName(bag.ResourceID())
 
 		var nextPageToken string
 		if res.Data.EntityEffectiveAccessEntries.PageInfo.HasNextPage {
 			ut.Token = res.Data.EntityEffectiveAccessEntries.PageInfo.EndCursor
+			ut.Depth++
 			userTypeTokenStr, err := ut.Marshal()
 			if err != nil {
 				return nil, "", fmt.Errorf("wiz-connector: error converting user type page token: %w", err)
@@ -362,136 +456,212 @@ func (c *Client) ListUsersWithAccessToResources(ctx context.Context, pToken *pag
 	return nil, "", errors.New("wiz-connector: failed to list users: invalid pagination resource type")
 }
 
+// ListResources returns a page of the resources selected by the scopes, leaving out those excluded by the scope
+// listing them. Scopes are walked one after the other and the pagination bag tracks the scope being walked. Each
+// resource is listed once, by the first scope selecting it, whose settings its effective access is read with, and
+// carries the names of every scope selecting it.
 func (c *Client) ListResources(ctx context.Context, pToken *pagination.Token) (*ResourceResponse, string, error) {
-	l := ctxzap.Extract(ctx)
-
-	whereClause := make(map[string]interface{}, 0)
-	if len(c.resourceIDs) != 0 {
-		whereClause["_vertexID"] = map[string]interface{}{
-			"EQUALS": c.resourceIDs,
-		}
+	bag := &pagination.Bag{}
+	err := bag.Unmarshal(pToken.Token)
+	if err != nil {
+		return nil, "", fmt.Errorf("wiz-connector: error parsing resources page token: %w", err)
 	}
-
-	if len(c.resourceTags) != 0 {
-		tagKeyValSlice := make([]map[string]interface{}, 0)
-		for _, tag := range c.resourceTags {
-			tagKeyValSlice = append(tagKeyValSlice, map[string]interface{}{
-				"key": tag.Key, "value": tag.Value,
-			})
-		}
-		whereClause["tags"] = map[string]interface{}{
-			"TAG_CONTAINS_ANY": tagKeyValSlice,
+	if bag.Current() == nil {
+		// The bag is a stack, push the scopes in reverse so they are walked in order.
+		for i := len(c.scopes) - 1; i >= 0; i-- {
+			bag.Push(pagination.PageState{ResourceTypeID: ListResourcesScope, ResourceID: c.scopes[i].Name})
 		}
 	}
+	if bag.Current() == nil {
+		return &ResourceResponse{}, "", nil
+	}
 
-	resourceTypes := c.resourceTypes
-	if len(resourceTypes) == 0 {
-		resourceTypes = []string{"ANY"} // TODO(lauren) might be able to filter with CLOUD_RESOURCE
+	scopeIndex := slices.IndexFunc(c.scopes, func(s *Scope) bool { return s.Name == bag.ResourceID() })
+	if scopeIndex == -1 {
+		return nil, "", fmt.Errorf("wiz-connector: invalid resources page token, unknown scope %q", bag.ResourceID())
 	}
+	scope := c.scopes[scopeIndex]
 
-	variables := map[string]interface{}{
-		"first":     DefaultPageSize,
-		"after":     pToken.Token,
-		"projectId": c.projectId,
-		"query": map[string]interface{}{
-			"type":  resourceTypes,
-			"where": whereClause,
-		},
+	var res *ResourceResponse
+	var scopeNextPageToken string
+	scopeToken := &pagination.Token{Token: bag.PageToken()}
+	if scope.principalIDs != nil {
+		res, scopeNextPageToken, err = c.listPrincipalResources(ctx, scope, scopeToken)
+	} else {
+		res, scopeNextPageToken, err = c.searchResources(ctx, scope, scopeToken)
 	}
-	payload := map[string]interface{}{
-		"query":     resourceQuery,
-		"variables": variables,
+	if err != nil {
+		return nil, "", err
 	}
 
-	options := []uhttp.RequestOption{
-		uhttp.WithAcceptJSONHeader(),
-		uhttp.WithJSONBody(payload),
-		WithBearerToken(c.BearerToken),
+	scope.exclusions.filterResources(res)
+	err = c.matchScopes(ctx, scopeIndex, res)
+	if err != nil {
+		return nil, "", err
+	}
+	c.recordResourceScopes(scope, res)
+	if c.incremental != nil {
+		for _, n := range res.Data.GraphSearch.Nodes {
+			for _, e := range n.Entities {
+				c.incremental.observe(&e)
+			}
+		}
 	}
 
-	req, err := c.baseHttpClient.NewRequest(ctx, http.MethodPost, c.BaseUrl, options...)
+	err = bag.Next(scopeNextPageToken)
 	if err != nil {
 		return nil, "", err
 	}
+	nextPageToken, err := bag.Marshal()
+	if err != nil {
+		return nil, "", err
+	}
+	return res, nextPageToken, nil
+}
+
+func (c *Client) searchResources(ctx context.Context, scope *Scope, pToken *pagination.Token) (*ResourceResponse, string, error) {
+	l := ctxzap.Extract(ctx)
+
+	cursor, err := parsePageCursor(pToken.Token)
+	if err != nil {
+		return nil, "", fmt.Errorf("wiz-connector: error parsing resources page token: %w", err)
+	}
 
 	res := &ResourceResponse{}
-	resp, err := c.baseHttpClient.Do(req, uhttp.WithJSONResponse(&res))
+	err = c.doQuery(withPageDepth(ctx, cursor.Depth), c.resourceQuery, scope.searchVariables(cursor.Cursor), res)
 	if err != nil {
 		l.Error("wiz-connector: failed to list resources",
 			zap.String("token", pToken.Token),
 			zap.Error(err))
 		return nil, "", fmt.Errorf("wiz-connector: failed to list resources: %w", err)
 	}
-	defer resp.Body.Close()
 
-	var nextPageToken string
-	if res.Data.GraphSearch.PageInfo.HasNextPage {
-		nextPageToken = res.Data.GraphSearch.PageInfo.EndCursor
+	nextPageToken, err := cursor.next(res.Data.GraphSearch.PageInfo)
+	if err != nil {
+		return nil, "", err
 	}
 
 	return res, nextPageToken, nil
 }
 
-func (c *Client) ListResourcePermissions(ctx context.Context, resourceId string, pToken *pagination.Token) (*ResourcePermissions, string, error) {
-	l := ctxzap.Extract(ctx)
-	bag, page, err := c.getGrantedEntityTypeToken(pToken.Token)
-	if err != nil {
-		return nil, "", fmt.Errorf("wiz-connector: error getting granted entity type page token: %w", err)
+// searchVariables returns the graph search variables of the page of the scope's resources after the cursor.
+func (s *Scope) searchVariables(after string) map[string]interface{} {
+	return s.resourceSearchVariables(s.ResourceIDs, after)
+}
+
+// resourceSearchVariables returns the graph search variables of the page of the scope's resources after the cursor,
+// limited to the resource ids when there are any.
+func (s *Scope) resourceSearchVariables(resourceIDs []string, after string) map[string]interface{} {
+	whereClause := make(map[string]interface{}, 0)
+	if len(resourceIDs) != 0 {
+		whereClause["_vertexID"] = map[string]interface{}{
+			"EQUALS": resourceIDs,
+		}
 	}
-	gt, err := parseGrantedEntityTypeToken(page)
-	if err != nil {
-		return nil, "", fmt.Errorf("wiz-connector: error parsing granted entity type page token: %w", err)
+
+	if len(s.ResourceTags) != 0 {
+		tagKeyValSlice := make([]map[string]interface{}, 0)
+		for _, tag := range s.ResourceTags {
+			tagKeyValSlice = append(tagKeyValSlice, map[string]interface{}{
+				"key": tag.Key, "value": tag.Value,
+			})
+		}
+		whereClause["tags"] = map[string]interface{}{
+			"TAG_CONTAINS_ANY": tagKeyValSlice,
+		}
 	}
 
-	variables := map[string]interface{}{
-		"first": DefaultPageSize,
-		"after": gt.Token,
-		"filterBy": map[string]interface{}{
-			"grantedEntityType": map[string]interface{}{
-				"equals": gt.GrantedEntityType,
-			},
-			"resource": map[string]interface{}{
-				"id": map[string]interface{}{
-					"equals": []string{resourceId},
-				},
-			},
-		},
+	resourceTypes := s.ResourceTypes
+	if len(resourceTypes) == 0 {
+		resourceTypes = []string{"ANY"} // TODO(lauren) might be able to filter with CLOUD_RESOURCE
 	}
 
-	payload := map[string]interface{}{
-		"query":     resourcePermissionQuery,
-		"variables": variables,
+	query := map[string]interface{}{
+		"type":  resourceTypes,
+		"where": whereClause,
 	}
+	s.Cloud.apply(query)
 
-	options := []uhttp.RequestOption{
-		uhttp.WithAcceptJSONHeader(),
-		uhttp.WithJSONBody(payload),
-		WithBearerToken(c.BearerToken),
+	return map[string]interface{}{
+		"first":     DefaultPageSize,
+		"after":     after,
+		"projectId": s.ProjectID,
+		"query":     query,
 	}
+}
 
-	req, err := c.baseHttpClient.NewRequest(ctx, http.MethodPost, c.BaseUrl, options...)
+// ListResourceEffectiveAccess returns a page of effective access entries for the resource, read with the settings of
+// the scope that listed it. Pages are shared with ListUsersWithAccessToResources through the effective access cache
+// for the rest of the sync.
+func (c *Client) ListResourceEffectiveAccess(ctx context.Context, resourceId string, pToken *pagination.Token) (*ResourcePermissions, string, error) {
+	res, nextPageToken, err := c.listEffectiveAccess(ctx, "resource effective access", c.resourceGrantedEntityTypes(resourceId), pToken, func(ctx context.Context, gt *GrantedEntityTypeToken) (*ResourcePermissions, error) {
+		return c.getEffectiveAccessPage(ctx, resourceId, gt)
+	})
 	if err != nil {
 		return nil, "", err
 	}
+	res.Scope = c.resourceScopeName(resourceId)
+	return res, nextPageToken, nil
+}
 
-	res := &ResourcePermissions{}
-	resp, err := c.baseHttpClient.Do(
-		req,
-		uhttp.WithJSONResponse(&res),
-	)
+// ListRoleEffectiveAccess returns a page of the effective access entries whose access path goes through the role or
+// policy, on any resource. A principal appears once per resource it reaches through the role. Entries are not tied to
+// a scope: they are read for every granted entity type a scope syncs, and only principals every scope excludes are
+// left out.
+func (c *Client) ListRoleEffectiveAccess(ctx context.Context, roleID string, pToken *pagination.Token) (*ResourcePermissions, string, error) {
+	return c.listEffectiveAccess(ctx, "role effective access", c.grantedEntityTypeFilter, pToken, func(ctx context.Context, gt *GrantedEntityTypeToken) (*ResourcePermissions, error) {
+		variables := map[string]interface{}{
+			"first": DefaultPageSize,
+			"after": gt.Token,
+			"filterBy": map[string]interface{}{
+				"grantedEntityType": map[string]interface{}{
+					"equals": gt.GrantedEntityType,
+				},
+				"accessPath": map[string]interface{}{
+					"id": map[string]interface{}{
+						"equals": []string{roleID},
+					},
+				},
+			},
+		}
+		res := &ResourcePermissions{}
+		err := c.doQuery(ctx, c.effectiveAccessQuery, variables, res)
+		if err != nil {
+			return nil, err
+		}
+		c.filterScopePrincipals(res)
+		c.filterExcludedPrincipals(res)
+		return res, nil
+	})
+}
+
+// listEffectiveAccess returns a page of effective access entries, walking each of the granted entity types in turn.
+// what names the entries in errors.
+func (c *Client) listEffectiveAccess(ctx context.Context, what string, grantedEntityTypes []string, pToken *pagination.Token, fetch func(context.Context, *GrantedEntityTypeToken) (*ResourcePermissions, error)) (*ResourcePermissions, string, error) {
+	l := ctxzap.Extract(ctx)
+	bag, page, err := getGrantedEntityTypeToken(pToken.Token, grantedEntityTypes)
+	if err != nil {
+		return nil, "", fmt.Errorf("wiz-connector: error getting granted entity type page token: %w", err)
+	}
+	gt, err := parseGrantedEntityTypeToken(page)
+	if err != nil {
+		return nil, "", fmt.Errorf("wiz-connector: error parsing granted entity type page token: %w", err)
+	}
+
+	res, err := fetch(withPageDepth(ctx, gt.Depth), gt)
 	if err != nil {
-		l.Error("wiz-connector: failed to list resources permissions",
+		l.Error("wiz-connector: failed to list "+what,
 			zap.String("page_token", pToken.Token),
 			zap.String("page", page),
 			zap.String("granted_entity_token", gt.Token),
 			zap.String("granted_entity_type", gt.GrantedEntityType),
 			zap.Error(err))
-		return nil, "", fmt.Errorf("wiz-connector: failed to list resources permissions: %w", err)
+		return nil, "", fmt.Errorf("wiz-connector: failed to list %s: %w", what, err)
 	}
-	defer resp.Body.Close()
 
 	if res.Data.EntityEffectiveAccessEntries.PageInfo.HasNextPage {
 		gt.Token = res.Data.EntityEffectiveAccessEntries.PageInfo.EndCursor
+		gt.Depth++
 		grantedEntityTypeTokenStr, err := gt.Marshal()
 		if err != nil {
 			return nil, "", fmt.Errorf("wiz-connector: error converting granted entity type page token: %w", err)
@@ -514,85 +684,59 @@ func (c *Client) ListResourcePermissions(ctx context.Context, resourceId string,
 	return res, nextPageToken, nil
 }
 
-func (c *Client) ListResourcePermissionEffectiveAccess(ctx context.Context, resourceId string, pToken *pagination.Token) (*ResourcePermissions, string, error) {
-	l := ctxzap.Extract(ctx)
-	bag, page, err := c.getGrantedEntityTypeToken(pToken.Token)
-	if err != nil {
-		return nil, "", fmt.Errorf("wiz-connector: error getting granted entity type page token: %w", err)
-	}
-	gt, err := parseGrantedEntityTypeToken(page)
-	if err != nil {
-		return nil, "", fmt.Errorf("wiz-connector: error parsing granted entity type page token: %w", err)
+// getEffectiveAccessPage returns the effective access page for the resource and granted entity type token, reading
+// from the cache when another builder has already fetched it.
+func (c *Client) getEffectiveAccessPage(ctx context.Context, resourceId string, gt *GrantedEntityTypeToken) (*ResourcePermissions, error) {
+	key := effectiveAccessPageKey{resourceID: resourceId, grantedEntityType: gt.GrantedEntityType, cursor: gt.Token}
+	if res, ok := c.effectiveAccessCache.get(key); ok {
+		return res, nil
 	}
 
-	variables := map[string]interface{}{
-		"first": DefaultPageSize,
-		"after": gt.Token,
-		"filterBy": map[string]interface{}{
-			"grantedEntityType": map[string]interface{}{
-				"equals": gt.GrantedEntityType,
-			},
-			"resource": map[string]interface{}{
-				"id": map[string]interface{}{
-					"equals": []string{resourceId},
-				},
+	filterBy := map[string]interface{}{
+		"grantedEntityType": map[string]interface{}{
+			"equals": gt.GrantedEntityType,
+		},
+		"resource": map[string]interface{}{
+			"id": map[string]interface{}{
+				"equals": []string{resourceId},
 			},
 		},
 	}
-	payload := map[string]interface{}{
-		"query":     resourceEffectiveAccessQuery,
-		"variables": variables,
-	}
 
-	options := []uhttp.RequestOption{
-		uhttp.WithAcceptJSONHeader(),
-		uhttp.WithJSONBody(payload),
-		WithBearerToken(c.BearerToken),
+	variables := map[string]interface{}{
+		"first":    DefaultPageSize,
+		"after":    gt.Token,
+		"filterBy": filterBy,
 	}
-
-	req, err := c.baseHttpClient.NewRequest(ctx, http.MethodPost, c.BaseUrl, options...)
+	res := &ResourcePermissions{}
+	err := c.doQuery(ctx, c.effectiveAccessQuery, variables, res)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	res := &ResourcePermissions{}
-	resp, err := c.baseHttpClient.Do(
-		req,
-		uhttp.WithJSONResponse(&res),
-	)
+	c.filterScopePrincipals(res)
+	c.resourceExclusions(resourceId).filterPrincipals(res)
+	err = c.effectiveAccessCache.put(key, res)
 	if err != nil {
-		l.Error("wiz-connector: failed to list resource permissions effective access",
-			zap.String("page_token", pToken.Token),
-			zap.String("page", page),
-			zap.String("granted_entity_token", gt.Token),
-			zap.String("granted_entity_type", gt.GrantedEntityType),
-			zap.Error(err))
-		return nil, "", fmt.Errorf("wiz-connector: failed to list resource permissions effective access: %w", err)
+		ctxzap.Extract(ctx).Warn("wiz-connector: failed to cache effective access page", zap.String("resource_id", resourceId), zap.Error(err))
 	}
-	defer resp.Body.Close()
 
-	if res.Data.EntityEffectiveAccessEntries.PageInfo.HasNextPage {
-		gt.Token = res.Data.EntityEffectiveAccessEntries.PageInfo.EndCursor
-		grantedEntityTypeTokenStr, err := gt.Marshal()
-		if err != nil {
-			return nil, "", fmt.Errorf("wiz-connector: error converting granted entity type page token: %w", err)
-		}
-		err = bag.Next(grantedEntityTypeTokenStr)
-		if err != nil {
-			return nil, "", fmt.Errorf("wiz-connector: failed to fetch bag.Next: %w", err)
-		}
-	} else {
-		err = bag.Next("")
-		if err != nil {
-			return nil, "", fmt.Errorf("wiz-connector: failed to fetch bag.Next: %w", err)
-		}
+	return res, nil
+}
+
+// filterScopePrincipals drops the entries of principals outside the scopes when every scope starts from principals.
+func (c *Client) filterScopePrincipals(res *ResourcePermissions) {
+	if c.principalIDs == nil {
+		return
 	}
-	nextPageToken, err := bag.Marshal()
-	if err != nil {
-		return nil, "", err
+	nodes := res.Data.EntityEffectiveAccessEntries.Nodes[:0]
+	for _, n := range res.Data.EntityEffectiveAccessEntries.Nodes {
+		if n.GrantedEntity == nil || !c.principalIDs.Contains(n.GrantedEntity.Id) {
+			continue
+		}
+		nodes = append(nodes, n)
 	}
-
-	return res, nextPageToken, nil
+	res.Data.EntityEffectiveAccessEntries.Nodes = nodes
 }
 
 func WithBearerToken(token string) uhttp.RequestOption {
@@ -609,7 +753,10 @@ func (c *Client) parseUserPageToken(token string, resourceIDs []string) (*pagina
 	if b.Current() == nil {
 		if len(resourceIDs) != 0 {
 			for _, resourceID := range resourceIDs {
-				for _, ut := range c.grantedEntityTypeFilter {
+				if c.Unchanged(resourceID) {
+					continue
+				}
+				for _, ut := range c.resourceGrantedEntityTypes(resourceID) {
 					userTypeWithToken := &GrantedEntityTypeToken{
 						GrantedEntityType: ut,
 					}
@@ -645,7 +792,7 @@ func parseGrantedEntityTypeToken(token string) (*GrantedEntityTypeToken, error)
 	return gtt, nil
 }
 
-func (c *Client) getGrantedEntityTypeToken(token string) (*pagination.Bag, string, error) {
+func getGrantedEntityTypeToken(token string, grantedEntityTypes []string) (*pagination.Bag, string, error) {
 	b := &pagination.Bag{}
 	err := b.Unmarshal(token)
 	if err != nil {
@@ -653,7 +800,7 @@ func (c *Client) getGrantedEntityTypeToken(token string) (*pagination.Bag, strin
 	}
 
 	if b.Current() == nil {
-		for _, gt := range c.grantedEntityTypeFilter {
+		for _, gt := range grantedEntityTypes {
 			grantedEntityTypeWithToken := &GrantedEntityTypeToken{
 				GrantedEntityType: gt,
 			}
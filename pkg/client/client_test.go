@@ -0,0 +1,32 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestClient returns a client of a fake Wiz API, whose GraphQL queries are answered by graphql.
+func newTestClient(t *testing.T, scopes []*Scope, export bool, graphql http.HandlerFunc) *Client {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token": "token", "token_type": "Bearer"}`))
+	})
+	mux.HandleFunc("/graphql", graphql)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	c, err := New(context.Background(), "id", StaticCredential("secret"), &Endpoints{
+		AuthURL:     server.URL + "/oauth/token",
+		EndpointURL: server.URL + "/graphql",
+		Audience:    "wiz-api",
+	}, &TransportOptions{}, scopes, false, false, false, false, false, false, false, export, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = c.ClearEffectiveAccessCache() })
+	return c
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenRefreshWindow is how long before it expires the access token is refreshed.
+const tokenRefreshWindow = time.Minute
+
+// CredentialSource provides the client secret of a Wiz service account. It is asked again every time the access
+// token is refreshed, so rotated secrets are picked up without restarting the connector.
+type CredentialSource interface {
+	ClientSecret(ctx context.Context) (string, error)
+}
+
+// StaticCredential is a client secret that never changes, such as one passed as a flag.
+type StaticCredential string
+
+func (s StaticCredential) ClientSecret(ctx context.Context) (string, error) {
+	if s == "" {
+		return "", fmt.Errorf("wiz-connector: client secret is empty")
+	}
+	return string(s), nil
+}
+
+// FileCredential reads the client secret from a file, such as a mounted Kubernetes secret, every time it is needed.
+type FileCredential struct {
+	Path string
+}
+
+func (f *FileCredential) ClientSecret(ctx context.Context) (string, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return "", fmt.Errorf("wiz-connector: error reading client secret file: %w", err)
+	}
+	return trimSecret(data, "file "+f.Path)
+}
+
+// ReaderCredential reads the client secret from a reader, such as stdin, once. A reader cannot be read again, so the
+// secret is kept for later refreshes.
+type ReaderCredential struct {
+	Reader io.Reader
+
+	once   sync.Once
+	secret string
+	err    error
+}
+
+func (r *ReaderCredential) ClientSecret(ctx context.Context) (string, error) {
+	r.once.Do(func() {
+		data, err := io.ReadAll(r.Reader)
+		if err != nil {
+			r.err = fmt.Errorf("wiz-connector: error reading client secret: %w", err)
+			return
+		}
+		r.secret, r.err = trimSecret(data, "input")
+	})
+	return r.secret, r.err
+}
+
+// CommandCredential runs a shell command, such as a vault helper, and uses its output as the client secret.
+type CommandCredential struct {
+	Command string
+}
+
+func (c *CommandCredential) ClientSecret(ctx context.Context) (string, error) {
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.Command)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("wiz-connector: error running client secret command: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return trimSecret(out, "command output")
+}
+
+func trimSecret(data []byte, from string) (string, error) {
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("wiz-connector: client secret %s is empty", from)
+	}
+	return secret, nil
+}
+
+// accessToken returns the bearer token for a request, refreshing it shortly before it expires.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.tokenMtx.Lock()
+	defer c.tokenMtx.Unlock()
+
+	if c.tokenExpiry.IsZero() || time.Until(c.tokenExpiry) > tokenRefreshWindow {
+		return c.BearerToken, nil
+	}
+
+	err := c.reauthorize(ctx)
+	if err != nil {
+		return "", fmt.Errorf("wiz-connector: error refreshing access token: %w", err)
+	}
+	return c.BearerToken, nil
+}
+
+// Reauthorize reads the client secret from the credential source again and requests a new access token.
+func (c *Client) Reauthorize(ctx context.Context) error {
+	c.tokenMtx.Lock()
+	defer c.tokenMtx.Unlock()
+
+	return c.reauthorize(ctx)
+}
+
+func (c *Client) reauthorize(ctx context.Context) error {
+	clientSecret, err := c.credentials.ClientSecret(ctx)
+	if err != nil {
+		return err
+	}
+	return c.Authorize(ctx, c.endpoints.AuthURL, c.clientID, clientSecret, c.endpoints.Audience)
+}
@@ -0,0 +1,176 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	EnvironmentCommercial = "commercial"
+	EnvironmentGov        = "gov"
+
+	AuthProviderCognito = "cognito"
+	AuthProviderAuth0   = "auth0"
+)
+
+var (
+	authURLs = map[string]map[string]string{
+		EnvironmentCommercial: {
+			AuthProviderCognito: "https://auth.app.wiz.io/oauth/token",
+			AuthProviderAuth0:   "https://auth.wiz.io/oauth/token",
+		},
+		EnvironmentGov: {
+			AuthProviderCognito: "https://auth.gov.wiz.io/oauth/token",
+			AuthProviderAuth0:   "https://auth0.gov.wiz.io/oauth/token",
+		},
+	}
+	audiences = map[string]string{
+		AuthProviderCognito: "wiz-api",
+		AuthProviderAuth0:   "beyond-api",
+	}
+	apiDomains = map[string]string{
+		EnvironmentCommercial: "app.wiz.io",
+		EnvironmentGov:        "app.wiz.us",
+	}
+	regionPattern = regexp.MustCompile(`^[a-z]+[0-9]+[a-z]*$`)
+)
+
+// Endpoints locate a Wiz tenant. URLs and audience left empty are derived from the region, environment and auth
+// provider; without a region, the endpoint url is derived from the data center of the access token.
+type Endpoints struct {
+	// Region is the Wiz data center of the tenant, such as us17 or eu1.
+	Region string
+	// Environment is commercial or gov. Defaults to the environment of the endpoint url, or commercial.
+	Environment string
+	// AuthProvider is cognito or auth0. Defaults to the provider of the auth url or audience, or cognito.
+	AuthProvider string
+	AuthURL      string
+	EndpointURL  string
+	Audience     string
+}
+
+// Resolve fills in the auth url, audience and, with a region, the endpoint url that were not set explicitly.
+func (e *Endpoints) Resolve() error {
+	e.Environment = strings.ToLower(e.Environment)
+	if e.Environment == "" {
+		e.Environment = endpointEnvironment(e.EndpointURL)
+	}
+	if _, ok := apiDomains[e.Environment]; !ok {
+		return fmt.Errorf("wiz-connector: invalid environment %q, must be %s or %s", e.Environment, EnvironmentCommercial, EnvironmentGov)
+	}
+
+	e.AuthProvider = strings.ToLower(e.AuthProvider)
+	if e.AuthProvider == "" && (e.AuthURL == "" || e.Audience == "") {
+		e.AuthProvider = e.inferAuthProvider()
+	}
+	if e.AuthProvider != "" {
+		if _, ok := audiences[e.AuthProvider]; !ok {
+			return fmt.Errorf("wiz-connector: invalid auth provider %q, must be %s or %s", e.AuthProvider, AuthProviderCognito, AuthProviderAuth0)
+		}
+		if e.AuthURL == "" {
+			e.AuthURL = authURLs[e.Environment][e.AuthProvider]
+		}
+		if e.Audience == "" {
+			e.Audience = audiences[e.AuthProvider]
+		}
+	}
+
+	if e.EndpointURL == "" && e.Region != "" {
+		endpointURL, err := e.endpointURL(e.Region)
+		if err != nil {
+			return err
+		}
+		e.EndpointURL = endpointURL
+	}
+
+	return nil
+}
+
+// inferAuthProvider returns the provider the configured auth url or audience belongs to. Without either, it is
+// cognito, the provider of current service accounts and of the wiz-api audience the connector has always defaulted to.
+func (e *Endpoints) inferAuthProvider() string {
+	for _, urls := range authURLs {
+		for provider, authURL := range urls {
+			if e.AuthURL == authURL {
+				return provider
+			}
+		}
+	}
+	for provider, audience := range audiences {
+		if e.Audience == audience {
+			return provider
+		}
+	}
+	return AuthProviderCognito
+}
+
+// endpointEnvironment returns the environment whose API domain serves the endpoint url, commercial when it is
+// empty or served elsewhere.
+func endpointEnvironment(endpointURL string) string {
+	u, err := url.Parse(endpointURL)
+	if err == nil {
+		for environment, domain := range apiDomains {
+			if strings.HasSuffix(u.Hostname(), "."+domain) {
+				return environment
+			}
+		}
+	}
+	return EnvironmentCommercial
+}
+
+func (e *Endpoints) endpointURL(region string) (string, error) {
+	region = strings.ToLower(region)
+	if !regionPattern.MatchString(region) {
+		return "", fmt.Errorf("wiz-connector: invalid region %q, expected a data center such as us17 or eu1", region)
+	}
+	return fmt.Sprintf("https://api.%s.%s/graphql", region, apiDomains[e.Environment]), nil
+}
+
+// resolveFromToken derives the endpoint url from the dc claim of the access token when it is still unknown.
+func (e *Endpoints) resolveFromToken(accessToken string) error {
+	if e.EndpointURL != "" {
+		return nil
+	}
+
+	dc, err := dataCenterFromToken(accessToken)
+	if err != nil {
+		return fmt.Errorf("wiz-connector: endpoint url or region is required, and the data center could not be read from the access token: %w", err)
+	}
+
+	endpointURL, err := e.endpointURL(dc)
+	if err != nil {
+		return err
+	}
+	e.EndpointURL = endpointURL
+	return nil
+}
+
+// dataCenterFromToken reads the dc claim of a Wiz access token. The token is not verified, it was just issued to us.
+func dataCenterFromToken(accessToken string) (string, error) {
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("access token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", fmt.Errorf("error decoding access token claims: %w", err)
+	}
+
+	claims := struct {
+		DataCenter string `json:"dc"`
+	}{}
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return "", fmt.Errorf("error parsing access token claims: %w", err)
+	}
+	if claims.DataCenter == "" {
+		return "", fmt.Errorf("access token has no dc claim")
+	}
+
+	return claims.DataCenter, nil
+}
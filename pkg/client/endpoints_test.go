@@ -0,0 +1,192 @@
+package client
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func testToken(claims string) string {
+	return "header." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".signature"
+}
+
+func TestDataCenterFromToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{name: "dc claim", token: testToken(`{"dc":"us17","sub":"abc"}`), want: "us17"},
+		{name: "padded payload", token: "header." + base64.URLEncoding.EncodeToString([]byte(`{"dc":"eu1"}`)) + ".signature", want: "eu1"},
+		{name: "not a jwt", token: "opaque-token", wantErr: true},
+		{name: "invalid base64", token: "header.!!!.signature", wantErr: true},
+		{name: "invalid json", token: testToken(`not json`), wantErr: true},
+		{name: "no dc claim", token: testToken(`{"sub":"abc"}`), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dataCenterFromToken(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("dataCenterFromToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("dataCenterFromToken() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndpointsResolve(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoints Endpoints
+		want      Endpoints
+		wantErr   bool
+	}{
+		{
+			name:      "cognito",
+			endpoints: Endpoints{AuthProvider: "Cognito"},
+			want: Endpoints{
+				Environment:  EnvironmentCommercial,
+				AuthProvider: AuthProviderCognito,
+				AuthURL:      "https://auth.app.wiz.io/oauth/token",
+				Audience:     "wiz-api",
+			},
+		},
+		{
+			name:      "region",
+			endpoints: Endpoints{Region: "US17", AuthProvider: AuthProviderCognito},
+			want: Endpoints{
+				Region:       "US17",
+				Environment:  EnvironmentCommercial,
+				AuthProvider: AuthProviderCognito,
+				AuthURL:      "https://auth.app.wiz.io/oauth/token",
+				EndpointURL:  "https://api.us17.app.wiz.io/graphql",
+				Audience:     "wiz-api",
+			},
+		},
+		{
+			name:      "commercial auth0",
+			endpoints: Endpoints{AuthProvider: AuthProviderAuth0},
+			want: Endpoints{
+				Environment:  EnvironmentCommercial,
+				AuthProvider: AuthProviderAuth0,
+				AuthURL:      "https://auth.wiz.io/oauth/token",
+				Audience:     "beyond-api",
+			},
+		},
+		{
+			name:      "gov auth0",
+			endpoints: Endpoints{Region: "us1", Environment: "GOV", AuthProvider: "auth0"},
+			want: Endpoints{
+				Region:       "us1",
+				Environment:  EnvironmentGov,
+				AuthProvider: AuthProviderAuth0,
+				AuthURL:      "https://auth0.gov.wiz.io/oauth/token",
+				EndpointURL:  "https://api.us1.app.wiz.us/graphql",
+				Audience:     "beyond-api",
+			},
+		},
+		{
+			name: "explicit urls without provider",
+			endpoints: Endpoints{
+				Region:      "eu1",
+				AuthURL:     "https://auth.example.com/oauth/token",
+				EndpointURL: "https://api.example.com/graphql",
+				Audience:    "custom",
+			},
+			want: Endpoints{
+				Region:      "eu1",
+				Environment: EnvironmentCommercial,
+				AuthURL:     "https://auth.example.com/oauth/token",
+				EndpointURL: "https://api.example.com/graphql",
+				Audience:    "custom",
+			},
+		},
+		{
+			name:      "no provider",
+			endpoints: Endpoints{Region: "us17"},
+			want: Endpoints{
+				Region:       "us17",
+				Environment:  EnvironmentCommercial,
+				AuthProvider: AuthProviderCognito,
+				AuthURL:      "https://auth.app.wiz.io/oauth/token",
+				EndpointURL:  "https://api.us17.app.wiz.io/graphql",
+				Audience:     "wiz-api",
+			},
+		},
+		{
+			name:      "no provider with auth url",
+			endpoints: Endpoints{AuthURL: "https://auth.example.com/oauth/token"},
+			want: Endpoints{
+				Environment:  EnvironmentCommercial,
+				AuthProvider: AuthProviderCognito,
+				AuthURL:      "https://auth.example.com/oauth/token",
+				Audience:     "wiz-api",
+			},
+		},
+		{
+			name:      "provider from auth url",
+			endpoints: Endpoints{AuthURL: "https://auth0.gov.wiz.io/oauth/token"},
+			want: Endpoints{
+				Environment:  EnvironmentCommercial,
+				AuthProvider: AuthProviderAuth0,
+				AuthURL:      "https://auth0.gov.wiz.io/oauth/token",
+				Audience:     "beyond-api",
+			},
+		},
+		{
+			name:      "provider from audience",
+			endpoints: Endpoints{Audience: "beyond-api"},
+			want: Endpoints{
+				Environment:  EnvironmentCommercial,
+				AuthProvider: AuthProviderAuth0,
+				AuthURL:      "https://auth.wiz.io/oauth/token",
+				Audience:     "beyond-api",
+			},
+		},
+		{
+			name:      "environment from endpoint url",
+			endpoints: Endpoints{EndpointURL: "https://api.us1.app.wiz.us/graphql"},
+			want: Endpoints{
+				Environment:  EnvironmentGov,
+				AuthProvider: AuthProviderCognito,
+				AuthURL:      "https://auth.gov.wiz.io/oauth/token",
+				EndpointURL:  "https://api.us1.app.wiz.us/graphql",
+				Audience:     "wiz-api",
+			},
+		},
+		{name: "invalid environment", endpoints: Endpoints{Environment: "staging", AuthProvider: AuthProviderCognito}, wantErr: true},
+		{name: "invalid auth provider", endpoints: Endpoints{AuthProvider: "okta"}, wantErr: true},
+		{name: "invalid region", endpoints: Endpoints{Region: "api.us17", AuthProvider: AuthProviderCognito}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.endpoints
+			err := e.Resolve()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && e != tt.want {
+				t.Errorf("Resolve() = %+v, want %+v", e, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndpointsResolveFromToken(t *testing.T) {
+	e := &Endpoints{Environment: EnvironmentGov}
+	err := e.resolveFromToken(testToken(`{"dc":"us2"}`))
+	if err != nil {
+		t.Fatalf("resolveFromToken() error = %v", err)
+	}
+	if want := "https://api.us2.app.wiz.us/graphql"; e.EndpointURL != want {
+		t.Errorf("EndpointURL = %q, want %q", e.EndpointURL, want)
+	}
+
+	e = &Endpoints{Environment: EnvironmentCommercial, EndpointURL: "https://api.example.com/graphql"}
+	err = e.resolveFromToken("opaque-token")
+	if err != nil {
+		t.Fatalf("resolveFromToken() with an endpoint url error = %v", err)
+	}
+}
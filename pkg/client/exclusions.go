@@ -0,0 +1,201 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// ExclusionRules drop noisy resources and principals from the sync, such as ephemeral autoscaling instances,
+// break-glass roles, Wiz's own scanner identity or AWS service-linked roles. A resource or principal matching any rule
+// is excluded.
+type ExclusionRules struct {
+	ResourceIDs []string
+	// ResourceNamePatterns and PrincipalNamePatterns are regular expressions matched against the name.
+	ResourceNamePatterns []string
+	ResourceTags         []*ResourceTag
+	// PrincipalIDs match the Wiz id, provider unique id, external id or email of a principal.
+	PrincipalIDs          []string
+	PrincipalNamePatterns []string
+	// NativeTypes and Providers apply to both resources and principals.
+	NativeTypes []string
+	Providers   []string
+}
+
+// exclusions applies the rules and records what they excluded, so the counts can be reported at the end of a sync.
+type exclusions struct {
+	rules          *ExclusionRules
+	resourceNames  []*regexp.Regexp
+	principalNames []*regexp.Regexp
+	resourcesSeen  mapset.Set[string]
+	principalsSeen mapset.Set[string]
+}
+
+func newExclusions(rules *ExclusionRules) (*exclusions, error) {
+	if rules == nil {
+		rules = &ExclusionRules{}
+	}
+	ex := &exclusions{
+		rules:          rules,
+		resourcesSeen:  mapset.NewSet[string](),
+		principalsSeen: mapset.NewSet[string](),
+	}
+
+	var err error
+	ex.resourceNames, err = compilePatterns(rules.ResourceNamePatterns)
+	if err != nil {
+		return nil, err
+	}
+	ex.principalNames, err = compilePatterns(rules.PrincipalNamePatterns)
+	if err != nil {
+		return nil, err
+	}
+	return ex, nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("wiz-connector: invalid exclusion pattern %q: %w", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// withRules returns exclusions applying other rules, recording what they exclude with the receiver, so the counts
+// cover every scope.
+func (ex *exclusions) withRules(rules *ExclusionRules) (*exclusions, error) {
+	rv, err := newExclusions(rules)
+	if err != nil {
+		return nil, err
+	}
+	rv.resourcesSeen = ex.resourcesSeen
+	rv.principalsSeen = ex.principalsSeen
+	return rv, nil
+}
+
+// needsResourceProperties reports whether resource rules read entity properties, which are otherwise not requested.
+func (ex *exclusions) needsResourceProperties() bool {
+	return len(ex.rules.ResourceTags) != 0 || len(ex.rules.NativeTypes) != 0 || len(ex.rules.Providers) != 0
+}
+
+// excludeResource reports whether the resource matches a rule, recording it if so.
+func (ex *exclusions) excludeResource(entity *GraphEntity) bool {
+	if !ex.matchResource(entity) {
+		return false
+	}
+	ex.resourcesSeen.Add(entity.Id)
+	return true
+}
+
+func (ex *exclusions) matchResource(entity *GraphEntity) bool {
+	if slices.Contains(ex.rules.ResourceIDs, entity.Id) ||
+		matchesAny(ex.resourceNames, entity.Name) ||
+		slices.Contains(ex.rules.NativeTypes, entity.Properties.NativeType) ||
+		slices.Contains(ex.rules.Providers, entity.Properties.CloudPlatform) {
+		return true
+	}
+	for _, tag := range ex.rules.ResourceTags {
+		if v, ok := entity.Properties.Tags[tag.Key]; ok && fmt.Sprint(v) == tag.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// excludePrincipal reports whether the granted entity matches a rule, recording it if so.
+func (ex *exclusions) excludePrincipal(entity *GrantedEntity) bool {
+	if !ex.matchPrincipal(entity) {
+		return false
+	}
+	ex.principalsSeen.Add(entity.Id)
+	return true
+}
+
+func (ex *exclusions) matchPrincipal(entity *GrantedEntity) bool {
+	for _, id := range []string{
+		entity.Id,
+		entity.ProviderUniqueId,
+		entity.Properties.ExternalId,
+		entity.Properties.PrimaryEmail,
+		entity.Properties.Email,
+	} {
+		if id != "" && slices.Contains(ex.rules.PrincipalIDs, id) {
+			return true
+		}
+	}
+	return matchesAny(ex.principalNames, entity.Name) ||
+		slices.Contains(ex.rules.NativeTypes, entity.Properties.NativeType) ||
+		slices.Contains(ex.rules.Providers, entity.Properties.CloudPlatform)
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterResources drops the excluded resources from the page.
+func (ex *exclusions) filterResources(res *ResourceResponse) {
+	for i, n := range res.Data.GraphSearch.Nodes {
+		entities := n.Entities[:0]
+		for _, e := range n.Entities {
+			if !ex.excludeResource(&e) {
+				entities = append(entities, e)
+			}
+		}
+		res.Data.GraphSearch.Nodes[i].Entities = entities
+	}
+}
+
+// filterPrincipals drops the effective access entries of excluded principals from the page.
+func (ex *exclusions) filterPrincipals(res *ResourcePermissions) {
+	nodes := res.Data.EntityEffectiveAccessEntries.Nodes[:0]
+	for _, n := range res.Data.EntityEffectiveAccessEntries.Nodes {
+		if n.GrantedEntity != nil && ex.excludePrincipal(n.GrantedEntity) {
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	res.Data.EntityEffectiveAccessEntries.Nodes = nodes
+}
+
+// excludedEverywhere reports whether every scope excludes the principal, for principals that are not read through a
+// resource and so belong to no single scope.
+func (c *Client) excludedEverywhere(entity *GrantedEntity) bool {
+	if len(c.scopes) == 0 {
+		return c.exclusions.matchPrincipal(entity)
+	}
+	for _, s := range c.scopes {
+		if !s.exclusions.matchPrincipal(entity) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterExcludedPrincipals drops the effective access entries of principals every scope excludes from the page.
+func (c *Client) filterExcludedPrincipals(res *ResourcePermissions) {
+	nodes := res.Data.EntityEffectiveAccessEntries.Nodes[:0]
+	for _, n := range res.Data.EntityEffectiveAccessEntries.Nodes {
+		if n.GrantedEntity != nil && c.excludedEverywhere(n.GrantedEntity) {
+			c.exclusions.principalsSeen.Add(n.GrantedEntity.Id)
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	res.Data.EntityEffectiveAccessEntries.Nodes = nodes
+}
+
+// ExclusionCounts reports how many distinct resources and principals exclusion rules have dropped so far.
+func (c *Client) ExclusionCounts() (resources int, principals int) {
+	return c.exclusions.resourcesSeen.Cardinality(), c.exclusions.principalsSeen.Cardinality()
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestExclusionsMatchResource(t *testing.T) {
+	rules := &ExclusionRules{
+		ResourceIDs:          []string{"r-excluded"},
+		ResourceNamePatterns: []string{`^eks-node-`},
+		ResourceTags:         []*ResourceTag{{Key: "env", Value: "ephemeral"}},
+		NativeTypes:          []string{"AWS::EC2::Instance"},
+		Providers:            []string{"OCI"},
+	}
+	ex, err := newExclusions(rules)
+	if err != nil {
+		t.Fatalf("newExclusions() error = %v", err)
+	}
+
+	resource := func(id string, name string, modify func(*GraphEntity)) *GraphEntity {
+		e := &GraphEntity{Id: id, Name: name}
+		if modify != nil {
+			modify(e)
+		}
+		return e
+	}
+	tests := []struct {
+		name   string
+		entity *GraphEntity
+		want   bool
+	}{
+		{name: "no rule", entity: resource("r1", "prod-bucket", nil), want: false},
+		{name: "id", entity: resource("r-excluded", "prod-bucket", nil), want: true},
+		{name: "name pattern", entity: resource("r1", "eks-node-abc", nil), want: true},
+		{name: "name pattern anchored", entity: resource("r1", "my-eks-node-abc", nil), want: false},
+		{name: "tag", entity: resource("r1", "cache", func(e *GraphEntity) {
+			e.Properties.Tags = map[string]interface{}{"env": "ephemeral"}
+		}), want: true},
+		{name: "tag with another value", entity: resource("r1", "cache", func(e *GraphEntity) {
+			e.Properties.Tags = map[string]interface{}{"env": "prod"}
+		}), want: false},
+		{name: "native type", entity: resource("r1", "web", func(e *GraphEntity) {
+			e.Properties.NativeType = "AWS::EC2::Instance"
+		}), want: true},
+		{name: "provider", entity: resource("r1", "web", func(e *GraphEntity) {
+			e.Properties.CloudPlatform = "OCI"
+		}), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ex.matchResource(tt.entity); got != tt.want {
+				t.Errorf("matchResource() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExclusionsMatchPrincipal(t *testing.T) {
+	rules := &ExclusionRules{
+		PrincipalIDs:          []string{"p-excluded", "AROAEXAMPLE", "scanner@example.com"},
+		PrincipalNamePatterns: []string{`^AWSServiceRoleFor`},
+		NativeTypes:           []string{"ServiceLinkedRole"},
+		Providers:             []string{"OCI"},
+	}
+	ex, err := newExclusions(rules)
+	if err != nil {
+		t.Fatalf("newExclusions() error = %v", err)
+	}
+
+	principal := func(id string, name string, modify func(*GrantedEntity)) *GrantedEntity {
+		e := &GrantedEntity{Id: id, Name: name}
+		if modify != nil {
+			modify(e)
+		}
+		return e
+	}
+	tests := []struct {
+		name   string
+		entity *GrantedEntity
+		want   bool
+	}{
+		{name: "no rule", entity: principal("p1", "alice", nil), want: false},
+		{name: "wiz id", entity: principal("p-excluded", "alice", nil), want: true},
+		{name: "provider unique id", entity: principal("p1", "deploy", func(e *GrantedEntity) {
+			e.ProviderUniqueId = "AROAEXAMPLE"
+		}), want: true},
+		{name: "external id", entity: principal("p1", "deploy", func(e *GrantedEntity) {
+			e.Properties.ExternalId = "AROAEXAMPLE"
+		}), want: true},
+		{name: "primary email", entity: principal("p1", "scanner", func(e *GrantedEntity) {
+			e.Properties.PrimaryEmail = "scanner@example.com"
+		}), want: true},
+		{name: "email", entity: principal("p1", "scanner", func(e *GrantedEntity) {
+			e.Properties.Email = "scanner@example.com"
+		}), want: true},
+		{name: "name pattern", entity: principal("p1", "AWSServiceRoleForSupport", nil), want: true},
+		{name: "native type", entity: principal("p1", "role", func(e *GrantedEntity) {
+			e.Properties.NativeType = "ServiceLinkedRole"
+		}), want: true},
+		{name: "provider", entity: principal("p1", "user", func(e *GrantedEntity) {
+			e.Properties.CloudPlatform = "OCI"
+		}), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ex.matchPrincipal(tt.entity); got != tt.want {
+				t.Errorf("matchPrincipal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExclusionsFilterPrincipals(t *testing.T) {
+	ex, err := newExclusions(&ExclusionRules{PrincipalIDs: []string{"p2"}})
+	if err != nil {
+		t.Fatalf("newExclusions() error = %v", err)
+	}
+
+	res := &ResourcePermissions{}
+	for _, id := range []string{"p1", "p2", "p3", "p2"} {
+		res.Data.EntityEffectiveAccessEntries.Nodes = append(res.Data.EntityEffectiveAccessEntries.Nodes, EffectiveAccessEntry{
+			GrantedEntity: &GrantedEntity{Id: id},
+		})
+	}
+	ex.filterPrincipals(res)
+
+	var got []string
+	for _, n := range res.Data.EntityEffectiveAccessEntries.Nodes {
+		got = append(got, n.GrantedEntity.Id)
+	}
+	if len(got) != 2 || got[0] != "p1" || got[1] != "p3" {
+		t.Errorf("filterPrincipals() kept %v, want [p1 p3]", got)
+	}
+	if n := ex.principalsSeen.Cardinality(); n != 1 {
+		t.Errorf("principals seen = %d, want 1", n)
+	}
+}
+
+func TestNewExclusionsInvalidPattern(t *testing.T) {
+	_, err := newExclusions(&ExclusionRules{ResourceNamePatterns: []string{"("}})
+	if err == nil {
+		t.Fatal("newExclusions() with an invalid pattern succeeded")
+	}
+}
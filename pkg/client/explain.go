@@ -0,0 +1,59 @@
+package client
+
+import (
+	"slices"
+)
+
+// ScopeQuery is the first query a scope lists its resources with, shown when explaining what a sync will do.
+type ScopeQuery struct {
+	Scope     string                 `json:"scope"`
+	ProjectID string                 `json:"project_id"`
+	Operation string                 `json:"operation"`
+	Variables map[string]interface{} `json:"variables"`
+	// Principals is the number of principals of a scope starting from principals, their resources are listed with
+	// one query per principal and the variables are those of the first one.
+	Principals int `json:"principals,omitempty"`
+}
+
+// ScopeQueries returns the first resources query of each scope, in the order scopes are listed.
+func (c *Client) ScopeQueries() []*ScopeQuery {
+	rv := make([]*ScopeQuery, 0, len(c.scopes))
+	for _, s := range c.scopes {
+		q := &ScopeQuery{Scope: s.Name, ProjectID: s.ProjectID}
+		if s.principalIDs != nil {
+			q.Operation = operationName(principalAccessQuery)
+			q.Variables = principalAccessVariables(s.principalIDs[0], "")
+			q.Principals = len(s.principalIDs)
+		} else {
+			q.Operation = operationName(c.resourceQuery)
+			q.Variables = s.searchVariables("")
+		}
+		rv = append(rv, q)
+	}
+	return rv
+}
+
+// ScopeProjectID returns the Wiz project the named scope lists resources in, "*" for every project.
+func (c *Client) ScopeProjectID(name string) string {
+	s := c.scope(name)
+	if s == nil {
+		return ""
+	}
+	return s.ProjectID
+}
+
+// GrantedEntityTypes returns every granted entity type a scope reads effective access for.
+func (c *Client) GrantedEntityTypes() []string {
+	return slices.Clone(c.grantedEntityTypeFilter)
+}
+
+// ResourceGrantedEntityTypes returns the granted entity types the resource's effective access is read for, those of
+// the scope that listed it. Its effective access is read with at least one call per type.
+func (c *Client) ResourceGrantedEntityTypes(resourceID string) []string {
+	return slices.Clone(c.resourceGrantedEntityTypes(resourceID))
+}
+
+// ReadResourceProperties makes resource listings carry the entity properties, such as the cloud account.
+func (c *Client) ReadResourceProperties() {
+	c.resourceQuery = buildResourceQuery(true)
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// linkedAccountsCacheSize is the number of identity provider subjects whose linked accounts are kept in memory.
+const linkedAccountsCacheSize = 4096
+
+// identitySearchResponse is a graph search returning principals, with the same properties as granted entities.
+type identitySearchResponse struct {
+	Data struct {
+		GraphSearch struct {
+			Nodes []struct {
+				Entities []*GrantedEntity `json:"entities"`
+			} `json:"nodes"`
+			PageInfo PageInfo `json:"pageInfo"`
+		} `json:"graphSearch"`
+	} `json:"data"`
+}
+
+// IdentitySubject returns the identity provider subject an account belongs to: the external id federated accounts
+// (e.g. AWS IAM Identity Center or GCP workforce users) carry of their identity provider user, or the provider unique
+// id of the account itself.
+func IdentitySubject(entity *GrantedEntity) string {
+	if entity.Properties.ExternalId != "" {
+		return entity.Properties.ExternalId
+	}
+	if entity.ProviderUniqueId != "" {
+		return entity.ProviderUniqueId
+	}
+	return entity.Properties.ProviderUniqueId
+}
+
+// LinkedAccounts returns every account Wiz links to the identity provider subject: the identity provider user whose
+// provider unique id is the subject, followed by the accounts federated from it through their external id, sorted
+// by Wiz id. Excluded principals are left out. Results only depend on Wiz data, so every sync phase and process
+// resolves the same accounts, and they are cached per subject.
+func (c *Client) LinkedAccounts(ctx context.Context, subject string) ([]*GrantedEntity, error) {
+	if accounts, ok := c.linkedAccountsCache.get(subject); ok {
+		return accounts, nil
+	}
+
+	principalTypes := []string{GrantedEntityTypeUserAccount, GrantedEntityTypeIdentity}
+	providers, err := c.searchIdentities(ctx, map[string]interface{}{
+		"type": principalTypes,
+		"where": map[string]interface{}{
+			"providerUniqueId": map[string]interface{}{"EQUALS": []string{subject}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	federated, err := c.searchIdentities(ctx, map[string]interface{}{
+		"type": principalTypes,
+		"where": map[string]interface{}{
+			"externalId": map[string]interface{}{"EQUALS": []string{subject}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortByID := func(a, b *GrantedEntity) int { return strings.Compare(a.Id, b.Id) }
+	slices.SortFunc(providers, sortByID)
+	slices.SortFunc(federated, sortByID)
+
+	var accounts []*GrantedEntity
+	seen := make(map[string]bool)
+	for _, account := range append(providers, federated...) {
+		if seen[account.Id] || c.excludedEverywhere(account) {
+			continue
+		}
+		seen[account.Id] = true
+		if account.ProviderUniqueId == "" {
+			account.ProviderUniqueId = account.Properties.ProviderUniqueId
+		}
+		accounts = append(accounts, account)
+	}
+
+	c.linkedAccountsCache.put(subject, accounts)
+	return accounts, nil
+}
+
+// searchIdentities returns every principal matching the graph query across all projects, walking all pages.
+func (c *Client) searchIdentities(ctx context.Context, query map[string]interface{}) ([]*GrantedEntity, error) {
+	var entities []*GrantedEntity
+	after := ""
+	for depth := 0; ; depth++ {
+		variables := map[string]interface{}{
+			"first":     DefaultPageSize,
+			"after":     after,
+			"projectId": "*",
+			"query":     query,
+		}
+
+		res := &identitySearchResponse{}
+		err := c.doQuery(withPageDepth(ctx, depth), buildResourceQuery(true), variables, res)
+		if err != nil {
+			return nil, fmt.Errorf("wiz-connector: failed to search linked accounts: %w", err)
+		}
+
+		for _, n := range res.Data.GraphSearch.Nodes {
+			entities = append(entities, n.Entities...)
+		}
+		if !res.Data.GraphSearch.PageInfo.HasNextPage {
+			return entities, nil
+		}
+		after = res.Data.GraphSearch.PageInfo.EndCursor
+	}
+}
@@ -0,0 +1,211 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// incremental decides which resources an incremental sync reads effective access for. The others are carried over
+// from the previous sync.
+type incremental struct {
+	since time.Time
+	// changed are resources that principals changed since the previous sync have access to.
+	changed mapset.Set[string]
+	// known reports whether the previous sync holds the resource.
+	known func(resourceID string) bool
+	// unchanged are the resources listed so far that can be carried over.
+	unchanged mapset.Set[string]
+}
+
+// EnableIncremental makes the client skip the effective access of resources left untouched since the previous sync
+// started: resources Wiz last updated before since, not among the changed resources and held by the previous sync.
+// Resources are judged as they are listed, so it must be called before the first ListResources.
+func (c *Client) EnableIncremental(since time.Time, changed mapset.Set[string], known func(resourceID string) bool) {
+	c.ReadResourceProperties()
+	c.incremental = &incremental{
+		since:     since,
+		changed:   changed,
+		known:     known,
+		unchanged: mapset.NewSet[string](),
+	}
+}
+
+// Unchanged reports whether the resource was listed and left untouched since the previous sync, in which case its
+// entitlements and grants can be carried over from it.
+func (c *Client) Unchanged(resourceID string) bool {
+	return c.incremental != nil && c.incremental.unchanged.ContainsOne(resourceID)
+}
+
+// observe records whether the listed resource is unchanged. Resources without an update time are always read.
+func (inc *incremental) observe(e *GraphEntity) {
+	updatedAt, err := time.Parse(time.RFC3339, e.Properties.UpdatedAt)
+	if err != nil || updatedAt.After(inc.since) || inc.changed.ContainsOne(e.Id) || !inc.known(e.Id) {
+		inc.unchanged.Remove(e.Id)
+		return
+	}
+	inc.unchanged.Add(e.Id)
+}
+
+// ErrChangesUnknown is returned by ChangedResources when Wiz cannot tell which entities it updated since a time,
+// so that an incremental sync would miss changes.
+var ErrChangesUnknown = errors.New("wiz-connector: the entities Wiz updated since the previous sync are unknown")
+
+// Changes are the resources whose effective access may have changed since a time.
+type Changes struct {
+	Resources mapset.Set[string]
+	// Principals and AccessPathEntities count the principals and the roles, role bindings and policies Wiz updated.
+	Principals         int
+	AccessPathEntities int
+}
+
+// ChangedResources returns the resources that principals, roles, role bindings and policies Wiz updated after since
+// give access to. The update condition is not part of the documented Wiz schema, so the search fails closed: when Wiz
+// rejects it or finds no updated entity at all, which an ignored condition cannot be told apart from, the error is
+// ErrChangesUnknown.
+func (c *Client) ChangedResources(ctx context.Context, since time.Time) (*Changes, error) {
+	resources, principals, err := c.changedPrincipalResources(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	accessPathResources, accessPathEntities, err := c.changedAccessPathResources(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	if principals == 0 && accessPathEntities == 0 {
+		return nil, fmt.Errorf("%w: no principal, role or policy updated since %s", ErrChangesUnknown, since.UTC().Format(time.RFC3339))
+	}
+	return &Changes{
+		Resources:          resources.Union(accessPathResources),
+		Principals:         principals,
+		AccessPathEntities: accessPathEntities,
+	}, nil
+}
+
+// changedPrincipalResources returns the resources that principals Wiz updated after since have effective access to,
+// along with the number of those principals. Principals are the synced granted entity types, groups, and the members
+// of updated groups, searched in the project of every scope.
+//
+// Principals Wiz deleted are not found, their grants on resources that did not change are carried over until the next
+// full sync.
+func (c *Client) changedPrincipalResources(ctx context.Context, since time.Time) (mapset.Set[string], int, error) {
+	principalTypes := append([]string{GrantedEntityTypeGroup}, c.grantedEntityTypeFilter...)
+	principals, err := c.searchScopeProjects(ctx, []map[string]interface{}{
+		{
+			"type":  principalTypes,
+			"where": updatedAfter(since),
+		},
+		{
+			// Membership changes update the group, access granted through it is reported on its members.
+			"type": []string{GrantedEntityTypeUserAccount, GrantedEntityTypeServiceAccount},
+			"relationships": []map[string]interface{}{{
+				"type": []map[string]interface{}{{"type": "CONTAINS", "reverse": true}},
+				"with": map[string]interface{}{
+					"type":  []string{GrantedEntityTypeGroup},
+					"where": updatedAfter(since),
+				},
+			}},
+		},
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrChangesUnknown, err)
+	}
+
+	resources := mapset.NewSet[string]()
+	for batch := range slices.Chunk(principals, scopeMembershipBatchSize) {
+		err = c.accessResources(ctx, "grantedEntity", batch, resources)
+		if err != nil {
+			return nil, 0, fmt.Errorf("wiz-connector: failed to list resources for changed principals: %w", err)
+		}
+	}
+	return resources, len(principals), nil
+}
+
+// changedAccessPathResources returns the resources effective access reaches through roles, role bindings and policies
+// Wiz updated after since, along with the number of those entities. Editing a role or policy changes the access of
+// every principal granted through it without updating the principals or the resources.
+func (c *Client) changedAccessPathResources(ctx context.Context, since time.Time) (mapset.Set[string], int, error) {
+	entities, err := c.searchScopeProjects(ctx, []map[string]interface{}{{
+		"type":  []string{AccessPathEntityTypeAccessRole, AccessPathEntityTypeAccessRoleBinding, AccessPathEntityTypeRawAccessPolicy},
+		"where": updatedAfter(since),
+	}})
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrChangesUnknown, err)
+	}
+
+	resources := mapset.NewSet[string]()
+	for batch := range slices.Chunk(entities, scopeMembershipBatchSize) {
+		err = c.accessResources(ctx, "accessPath", batch, resources)
+		if err != nil {
+			return nil, 0, fmt.Errorf("wiz-connector: failed to list resources for changed roles and policies: %w", err)
+		}
+	}
+	return resources, len(entities), nil
+}
+
+// updatedAfter is the graph search condition on entities Wiz updated after since, on the updatedAt property resources
+// carry. The property and the AFTER operator are not part of the documented Wiz schema, see ChangedResources for how
+// their failure is handled. If Wiz ignores the condition, every principal and role is treated as changed and the sync
+// reads the effective access of every resource, like a full sync.
+func updatedAfter(since time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"updatedAt": map[string]interface{}{"AFTER": since.UTC().Format(time.RFC3339)},
+	}
+}
+
+// searchScopeProjects returns the sorted ids of the graph entities matching any of the queries in the project of
+// every scope.
+func (c *Client) searchScopeProjects(ctx context.Context, queries []map[string]interface{}) ([]string, error) {
+	ids := mapset.NewThreadUnsafeSet[string]()
+	projects := mapset.NewThreadUnsafeSet[string]()
+	for _, s := range c.scopes {
+		if !projects.Add(s.ProjectID) {
+			continue
+		}
+		for _, query := range queries {
+			found, err := c.searchEntityIDs(ctx, s.ProjectID, query)
+			if err != nil {
+				return nil, err
+			}
+			ids.Append(found...)
+		}
+	}
+	rv := ids.ToSlice()
+	slices.Sort(rv)
+	return rv, nil
+}
+
+// accessResources adds the resources of the effective access entries whose field, grantedEntity or accessPath, is
+// one of the ids to resources, walking all pages.
+func (c *Client) accessResources(ctx context.Context, field string, ids []string, resources mapset.Set[string]) error {
+	after := ""
+	for depth := 0; ; depth++ {
+		variables := map[string]interface{}{
+			"first": DefaultPageSize,
+			"after": after,
+			"filterBy": map[string]interface{}{
+				field: map[string]interface{}{
+					"id": map[string]interface{}{"equals": ids},
+				},
+			},
+		}
+		access := &PrincipalAccessResponse{}
+		err := c.doQuery(withPageDepth(ctx, depth), principalAccessQuery, variables, access)
+		if err != nil {
+			return err
+		}
+		for _, n := range access.Data.EntityEffectiveAccessEntries.Nodes {
+			if n.Resource != nil {
+				resources.Add(n.Resource.Id)
+			}
+		}
+		if !access.Data.EntityEffectiveAccessEntries.PageInfo.HasNextPage {
+			return nil
+		}
+		after = access.Data.EntityEffectiveAccessEntries.PageInfo.EndCursor
+	}
+}
@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// changesHandler answers graph searches for updated principals with principals, and access queries with one resource
+// per principal, counting the access queries.
+func changesHandler(principals []string, calls *atomic.Int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables struct {
+				Query *struct {
+					Type  []string        `json:"type"`
+					Where json.RawMessage `json:"where"`
+				} `json:"query"`
+				FilterBy struct {
+					GrantedEntity struct {
+						ID struct {
+							Equals []string `json:"equals"`
+						} `json:"id"`
+					} `json:"grantedEntity"`
+				} `json:"filterBy"`
+			} `json:"variables"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			http.Error(w, "unexpected query", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		if q := body.Variables.Query; q != nil {
+			res := &ResourceResponse{}
+			if slices.Contains(q.Type, GrantedEntityTypeGroup) && q.Where != nil {
+				for _, id := range principals {
+					res.Data.GraphSearch.Nodes = append(res.Data.GraphSearch.Nodes, GraphSearchNode{Entities: []GraphEntity{{Id: id}}})
+				}
+			}
+			_ = json.NewEncoder(w).Encode(res)
+			return
+		}
+
+		calls.Add(1)
+		var nodes []map[string]interface{}
+		for _, id := range body.Variables.FilterBy.GrantedEntity.ID.Equals {
+			nodes = append(nodes, map[string]interface{}{"resource": map[string]string{"id": id + "-resource"}})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"entityEffectiveAccessEntries": map[string]interface{}{"nodes": nodes},
+			},
+		})
+	}
+}
+
+func TestChangedPrincipalResources(t *testing.T) {
+	const changed = 250
+	principals := make([]string, 0, changed)
+	for i := range changed {
+		principals = append(principals, fmt.Sprintf("p%03d", i))
+	}
+	calls := &atomic.Int64{}
+	c := newTestClient(t, []*Scope{{ProjectID: "project"}}, false, changesHandler(principals, calls))
+
+	resources, found, err := c.changedPrincipalResources(context.Background(), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("changedPrincipalResources() error = %v", err)
+	}
+	if found != changed {
+		t.Errorf("changedPrincipalResources() found %d principals, want %d", found, changed)
+	}
+	if got := resources.Cardinality(); got != changed {
+		t.Errorf("changedPrincipalResources() returned %d resources, want %d", got, changed)
+	}
+	if got, want := calls.Load(), int64((changed+scopeMembershipBatchSize-1)/scopeMembershipBatchSize); got != want {
+		t.Errorf("changedPrincipalResources() made %d access queries, want one per batch: %d", got, want)
+	}
+}
+
+func TestChangedResources(t *testing.T) {
+	rejectSearch := func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errors": [{"message": "unknown field updatedAt"}]}`, http.StatusBadRequest)
+	}
+	tests := []struct {
+		name    string
+		graphql http.HandlerFunc
+		want    int
+		wantErr error
+	}{
+		{name: "updated principals", graphql: changesHandler([]string{"p1", "p2"}, &atomic.Int64{}), want: 2},
+		{name: "nothing updated", graphql: changesHandler(nil, &atomic.Int64{}), wantErr: ErrChangesUnknown},
+		{name: "condition rejected", graphql: rejectSearch, wantErr: ErrChangesUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, []*Scope{{ProjectID: "project"}}, false, tt.graphql)
+			changes, err := c.ChangedResources(context.Background(), time.Now().Add(-time.Hour))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ChangedResources() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && changes.Resources.Cardinality() != tt.want {
+				t.Errorf("ChangedResources() returned %d resources, want %d", changes.Resources.Cardinality(), tt.want)
+			}
+		})
+	}
+}
@@ -40,51 +40,189 @@ type GrantedEntity struct {
 	Type             string `json:"type"`
 	ProviderUniqueId string `json:"providerUniqueId"`
 	Properties       struct {
-		Email            string `json:"email"`
-		Emails           Emails `json:"emails,omitempty"`
-		PrimaryEmail     string `json:"primaryEmail"`
-		Enabled          *bool  `json:"accountEnabled"`
-		ExternalId       string `json:"externalId"`
-		NativeType       string `json:"nativeType"`
-		Name             string `json:"name"`
-		ProviderUniqueId string `json:"providerUniqueId"`
+		Email             string `json:"email"`
+		Emails            Emails `json:"emails,omitempty"`
+		PrimaryEmail      string `json:"primaryEmail"`
+		Enabled           *bool  `json:"accountEnabled"`
+		ExternalId        string `json:"externalId"`
+		NativeType        string `json:"nativeType"`
+		Name              string `json:"name"`
+		ProviderUniqueId  string `json:"providerUniqueId"`
+		CloudPlatform     string `json:"cloudPlatform"`
+		UserPrincipalName string `json:"userPrincipalName"`
 	} `json:"properties"`
 }
 
-type UsersWithAccessQueryResponse struct {
+// AccessPathEntity is one hop between a granted entity and a resource, such as a group membership, an assumed
+// role, an attached policy or a resource policy.
+type AccessPathEntity struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Properties struct {
+		NativeType    string `json:"nativeType"`
+		CloudPlatform string `json:"cloudPlatform"`
+	} `json:"properties"`
+}
+
+// EffectiveAccessEntry is the access a granted entity has on a resource.
+type EffectiveAccessEntry struct {
+	GrantedEntity *GrantedEntity      `json:"grantedEntity"`
+	Permissions   []string            `json:"permissions"`
+	AccessPath    []*AccessPathEntity `json:"accessPath"`
+	AccessTypes   []string            `json:"accessTypes"`
+}
+
+type ResourcePermissions struct {
 	Data struct {
 		EntityEffectiveAccessEntries struct {
-			Nodes []struct {
-				GrantedEntity *GrantedEntity `json:"grantedEntity"`
-			} `json:"nodes"`
-			PageInfo PageInfo `json:"pageInfo"`
+			Nodes    []EffectiveAccessEntry `json:"nodes"`
+			PageInfo PageInfo               `json:"pageInfo"`
 		} `json:"entityEffectiveAccessEntries"`
 	} `json:"data"`
+	// Scope is the name of the scope that listed the resource the entries are on, whose settings they were read
+	// with. It is empty for the scope built from flags and for entries not read for a single resource.
+	Scope string `json:"-"`
 }
 
-type ResourcePermissions struct {
+// ResourceProperties holds the graph entity properties the connector reads, such as Wiz's public exposure flag. They
+// are only populated when the resource query requests properties.
+type ResourceProperties struct {
+	// IsAccessibleFromInternet is Wiz's public exposure flag for the resource.
+	IsAccessibleFromInternet bool `json:"isAccessibleFromInternet"`
+	// NativeType, CloudPlatform and Tags are read by exclusion rules.
+	NativeType    string                 `json:"nativeType"`
+	CloudPlatform string                 `json:"cloudPlatform"`
+	Tags          map[string]interface{} `json:"tags"`
+	// SubscriptionExternalId is the AWS account ID, Azure subscription ID or GCP project ID holding the resource.
+	SubscriptionExternalId string `json:"subscriptionExternalId"`
+	SubscriptionName       string `json:"subscriptionName"`
+	// UpdatedAt is when Wiz last saw the resource change, read by incremental syncs.
+	UpdatedAt string `json:"updatedAt"`
+}
+
+type GraphEntity struct {
+	Id         string             `json:"id"`
+	Name       string             `json:"name"`
+	Type       string             `json:"type"`
+	Properties ResourceProperties `json:"properties"`
+	// Scopes are the names of the sync scopes that matched the entity, set by ListResources.
+	Scopes []string `json:"-"`
+}
+
+// ListedBy returns the name of the scope that listed the entity, the first scope matching it. It is empty for the
+// scope built from flags.
+func (e *GraphEntity) ListedBy() string {
+	if len(e.Scopes) == 0 {
+		return ""
+	}
+	return e.Scopes[0]
+}
+
+type GraphSearchNode struct {
+	Entities []GraphEntity `json:"entities"`
+}
+
+type ResourceResponse struct {
+	Data struct {
+		GraphSearch struct {
+			Nodes    []GraphSearchNode `json:"nodes"`
+			PageInfo PageInfo          `json:"pageInfo"`
+		} `json:"graphSearch"`
+	} `json:"data"`
+}
+
+// PrincipalAccessResponse lists the resources a principal has effective access to.
+type PrincipalAccessResponse struct {
 	Data struct {
 		EntityEffectiveAccessEntries struct {
 			Nodes []struct {
-				GrantedEntity *GrantedEntity `json:"grantedEntity"`
-				Permissions   []string       `json:"permissions"`
+				Resource *GraphEntity `json:"resource"`
 			} `json:"nodes"`
 			PageInfo PageInfo `json:"pageInfo"`
 		} `json:"entityEffectiveAccessEntries"`
 	} `json:"data"`
 }
 
-type ResourceResponse struct {
+type Issue struct {
+	Id             string `json:"id"`
+	Severity       string `json:"severity"`
+	Type           string `json:"type"`
+	Status         string `json:"status"`
+	EntitySnapshot struct {
+		Id            string `json:"id"`
+		Name          string `json:"name"`
+		Type          string `json:"type"`
+		NativeType    string `json:"nativeType"`
+		CloudPlatform string `json:"cloudPlatform"`
+	} `json:"entitySnapshot"`
+	// The fields below are only requested when issues are synced as resources.
+	CreatedAt  string `json:"createdAt"`
+	DueAt      string `json:"dueAt"`
+	SourceRule *struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"sourceRule"`
+	Projects []*struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"projects"`
+	Assignee *IssueAssignee `json:"assignee"`
+}
+
+type IssueAssignee struct {
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type IssuesResponse struct {
 	Data struct {
-		GraphSearch struct {
-			Nodes []struct {
-				Entities []struct {
-					Id   string `json:"id"`
-					Name string `json:"name"`
-					Type string `json:"type"`
-				} `json:"entities"`
-			} `json:"nodes"`
+		Issues struct {
+			Nodes    []*Issue `json:"nodes"`
 			PageInfo PageInfo `json:"pageInfo"`
-		} `json:"graphSearch"`
+		} `json:"issues"`
+	} `json:"data"`
+}
+
+type VulnerabilityFinding struct {
+	Id              string `json:"id"`
+	Severity        string `json:"severity"`
+	VulnerableAsset struct {
+		Id string `json:"id"`
+	} `json:"vulnerableAsset"`
+}
+
+// DataFinding is data matching one of Wiz's data classifiers, such as credit card numbers, found on a resource by
+// Wiz's data scanning.
+type DataFinding struct {
+	Id             string `json:"id"`
+	Severity       string `json:"severity"`
+	DataClassifier struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+		// Category is the kind of data the classifier finds, such as PII, PHI, PCI or SECRETS.
+		Category string `json:"category"`
+	} `json:"dataClassifier"`
+	GraphEntity struct {
+		Id string `json:"id"`
+	} `json:"graphEntity"`
+}
+
+type DataFindingsResponse struct {
+	Data struct {
+		DataFindings struct {
+			Nodes    []*DataFinding `json:"nodes"`
+			PageInfo PageInfo       `json:"pageInfo"`
+		} `json:"dataFindingsV2"`
+	} `json:"data"`
+}
+
+type VulnerabilityFindingsResponse struct {
+	Data struct {
+		VulnerabilityFindings struct {
+			Nodes    []*VulnerabilityFinding `json:"nodes"`
+			PageInfo PageInfo                `json:"pageInfo"`
+		} `json:"vulnerabilityFindings"`
 	} `json:"data"`
 }
@@ -0,0 +1,207 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const principalAccessQuery = `query PrincipalEntitlementsTable($after: String, $first: Int, $filterBy: EntityEffectiveAccessFilters) {
+  entityEffectiveAccessEntries(after: $after, first: $first, filterBy: $filterBy) {
+    nodes {
+      resource {
+        id
+        name
+        type
+        properties
+      }
+    }
+    pageInfo {
+      hasNextPage
+      endCursor
+    }
+  }
+}`
+
+// PrincipalFilter selects the principals an identity-centric sync starts from. Principals matching any of the
+// emails, group ids or identity providers are selected.
+type PrincipalFilter struct {
+	Emails            []string
+	GroupIDs          []string
+	IdentityProviders []string
+}
+
+// Empty reports whether no principals are selected, in which case the sync starts from resources.
+func (pf *PrincipalFilter) Empty() bool {
+	return pf == nil || len(pf.Emails) == 0 && len(pf.GroupIDs) == 0 && len(pf.IdentityProviders) == 0
+}
+
+// resolvePrincipals returns the Wiz ids of the principals selected by the filter: users by email, groups by id
+// along with their members, and the users and groups of an identity provider by their cloud platform.
+func (c *Client) resolvePrincipals(ctx context.Context, scope *Scope) ([]string, error) {
+	pf := scope.Principals
+	ids := slices.Clone(pf.GroupIDs)
+
+	var queries []map[string]interface{}
+	if len(pf.Emails) != 0 {
+		queries = append(queries, map[string]interface{}{
+			"type": []string{GrantedEntityTypeUserAccount},
+			"where": map[string]interface{}{
+				"email": map[string]interface{}{"EQUALS": pf.Emails},
+			},
+		})
+	}
+	if len(pf.GroupIDs) != 0 {
+		// Access granted through a group is reported on its members, so they are selected along with the group.
+		queries = append(queries, map[string]interface{}{
+			"type": []string{GrantedEntityTypeUserAccount, GrantedEntityTypeServiceAccount},
+			"relationships": []map[string]interface{}{{
+				"type": []map[string]interface{}{{"type": "CONTAINS", "reverse": true}},
+				"with": map[string]interface{}{
+					"type": []string{GrantedEntityTypeGroup},
+					"where": map[string]interface{}{
+						"_vertexID": map[string]interface{}{"EQUALS": pf.GroupIDs},
+					},
+				},
+			}},
+		})
+	}
+	if len(pf.IdentityProviders) != 0 {
+		queries = append(queries, map[string]interface{}{
+			"type": []string{GrantedEntityTypeUserAccount, GrantedEntityTypeGroup},
+			"where": map[string]interface{}{
+				"cloudPlatform": map[string]interface{}{"EQUALS": pf.IdentityProviders},
+			},
+		})
+	}
+
+	for _, query := range queries {
+		found, err := c.searchEntityIDs(ctx, scope.ProjectID, query)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, found...)
+	}
+
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("wiz-connector: no principals matched the principal emails, group ids or identity providers of scope %q", scope.Name)
+	}
+	return ids, nil
+}
+
+// searchEntityIDs returns the ids of every graph entity matching the graph query, walking all pages.
+func (c *Client) searchEntityIDs(ctx context.Context, projectID string, query map[string]interface{}) ([]string, error) {
+	var ids []string
+	after := ""
+	for depth := 0; ; depth++ {
+		variables := map[string]interface{}{
+			"first":     DefaultPageSize,
+			"after":     after,
+			"projectId": projectID,
+			"query":     query,
+		}
+
+		res := &ResourceResponse{}
+		err := c.doQuery(withPageDepth(ctx, depth), buildResourceQuery(false), variables, res)
+		if err != nil {
+			return nil, fmt.Errorf("wiz-connector: failed to search principals: %w", err)
+		}
+
+		for _, n := range res.Data.GraphSearch.Nodes {
+			for _, e := range n.Entities {
+				ids = append(ids, e.Id)
+			}
+		}
+		if !res.Data.GraphSearch.PageInfo.HasNextPage {
+			return ids, nil
+		}
+		after = res.Data.GraphSearch.PageInfo.EndCursor
+	}
+}
+
+// listPrincipalResources returns a page of the resources the scope's principals have effective access to. The
+// bag walks the principals one at a time, so a resource reachable by several principals can be returned more than
+// once; callers already tolerate repeated resources.
+func (c *Client) listPrincipalResources(ctx context.Context, scope *Scope, pToken *pagination.Token) (*ResourceResponse, string, error) {
+	l := ctxzap.Extract(ctx)
+
+	bag := &pagination.Bag{}
+	err := bag.Unmarshal(pToken.Token)
+	if err != nil {
+		return nil, "", fmt.Errorf("wiz-connector: error parsing principal resources page token: %w", err)
+	}
+	if bag.Current() == nil {
+		for _, id := range scope.principalIDs {
+			bag.Push(pagination.PageState{ResourceID: id})
+		}
+	}
+	if bag.Current() == nil {
+		return &ResourceResponse{}, "", nil
+	}
+
+	cursor, err := parsePageCursor(bag.PageToken())
+	if err != nil {
+		return nil, "", fmt.Errorf("wiz-connector: error parsing principal resources page token: %w", err)
+	}
+
+	access := &PrincipalAccessResponse{}
+	err = c.doQuery(withPageDepth(ctx, cursor.Depth), principalAccessQuery, principalAccessVariables(bag.ResourceID(), cursor.Cursor), access)
+	if err != nil {
+		l.Error("wiz-connector: failed to list resources for principal",
+			zap.String("principal_id", bag.ResourceID()),
+			zap.String("page_token", pToken.Token),
+			zap.Error(err))
+		return nil, "", fmt.Errorf("wiz-connector: failed to list resources for principal: %w", err)
+	}
+
+	res := &ResourceResponse{}
+	node := GraphSearchNode{}
+	seen := make(map[string]bool)
+	for _, n := range access.Data.EntityEffectiveAccessEntries.Nodes {
+		if n.Resource == nil || seen[n.Resource.Id] {
+			continue
+		}
+		if len(scope.ResourceTypes) != 0 && !slices.Contains(scope.ResourceTypes, n.Resource.Type) {
+			continue
+		}
+		seen[n.Resource.Id] = true
+		node.Entities = append(node.Entities, *n.Resource)
+	}
+	res.Data.GraphSearch.Nodes = []GraphSearchNode{node}
+
+	principalNextPageToken, err := cursor.next(access.Data.EntityEffectiveAccessEntries.PageInfo)
+	if err != nil {
+		return nil, "", err
+	}
+	err = bag.Next(principalNextPageToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextPageToken, err := bag.Marshal()
+	if err != nil {
+		return nil, "", err
+	}
+	return res, nextPageToken, nil
+}
+
+// principalAccessVariables returns the variables of the page of the principal's resources after the cursor.
+func principalAccessVariables(principalID string, after string) map[string]interface{} {
+	return map[string]interface{}{
+		"first": DefaultPageSize,
+		"after": after,
+		"filterBy": map[string]interface{}{
+			"grantedEntity": map[string]interface{}{
+				"id": map[string]interface{}{
+					"equals": []string{principalID},
+				},
+			},
+		},
+	}
+}
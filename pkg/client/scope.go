@@ -0,0 +1,312 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// Scope selects what one part of a sync covers: resources by id, tags, resource types and cloud account within a
+// Wiz project, or the resources reachable by a set of principals. A sync covers the union of its scopes.
+type Scope struct {
+	// Name identifies the scope in pagination tokens and resource annotations. The scope built from flags is unnamed.
+	Name          string
+	ResourceIDs   []string
+	ResourceTags  []*ResourceTag
+	ResourceTypes []string
+	ProjectID     string
+	Cloud         *CloudScope
+	Principals    *PrincipalFilter
+	// GrantedEntityTypes and Exclusions apply to the resources the scope lists, in place of the client's when set.
+	// User accounts are always synced, and groups in external sync mode.
+	GrantedEntityTypes []string
+	Exclusions         *ExclusionRules
+
+	// principalIDs are the resolved principals of a scope starting from principals.
+	principalIDs []string
+	// grantedEntityTypeFilter and exclusions are the settings effective access of the scope's resources is read with.
+	grantedEntityTypeFilter []string
+	exclusions              *exclusions
+}
+
+func (c *Client) scope(name string) *Scope {
+	for _, s := range c.scopes {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// resourceScope returns the scope that listed the resource, nil when it was not listed by ListResources.
+func (c *Client) resourceScope(resourceID string) *Scope {
+	if len(c.scopes) == 1 {
+		return c.scopes[0]
+	}
+	c.resourceScopesMtx.Lock()
+	defer c.resourceScopesMtx.Unlock()
+	return c.resourceScopes[resourceID]
+}
+
+// recordResourceScopes remembers the scope that listed each resource of the page, so its effective access is read
+// with that scope's settings. Like the sync, it keeps the first scope listing a resource. With a single scope every
+// resource belongs to it and nothing is recorded.
+func (c *Client) recordResourceScopes(scope *Scope, res *ResourceResponse) {
+	if len(c.scopes) == 1 {
+		return
+	}
+	c.resourceScopesMtx.Lock()
+	defer c.resourceScopesMtx.Unlock()
+	for _, n := range res.Data.GraphSearch.Nodes {
+		for _, e := range n.Entities {
+			if _, ok := c.resourceScopes[e.Id]; !ok {
+				c.resourceScopes[e.Id] = scope
+			}
+		}
+	}
+}
+
+// resourceGrantedEntityTypes returns the granted entity types the resource's effective access is read for.
+func (c *Client) resourceGrantedEntityTypes(resourceID string) []string {
+	if s := c.resourceScope(resourceID); s != nil {
+		return s.grantedEntityTypeFilter
+	}
+	return c.grantedEntityTypeFilter
+}
+
+// resourceExclusions returns the exclusions applied to the principals with access to the resource.
+func (c *Client) resourceExclusions(resourceID string) *exclusions {
+	if s := c.resourceScope(resourceID); s != nil {
+		return s.exclusions
+	}
+	return c.exclusions
+}
+
+// resourceScopeName returns the name of the scope that listed the resource.
+func (c *Client) resourceScopeName(resourceID string) string {
+	if s := c.resourceScope(resourceID); s != nil {
+		return s.Name
+	}
+	return ""
+}
+
+// seedResourceIDs returns the resource ids users can be listed from directly, without searching for resources. That
+// is only possible with a single scope selecting resources by id alone.
+func (c *Client) seedResourceIDs() []string {
+	if len(c.scopes) != 1 {
+		return nil
+	}
+	s := c.scopes[0]
+	if !s.Principals.Empty() || !s.Cloud.Empty() {
+		return nil
+	}
+	return s.ResourceIDs
+}
+
+// resolveScopePrincipals resolves the principals of the scopes starting from principals. When every scope does,
+// effective access is limited to those principals; otherwise resources selected directly keep all their principals.
+func (c *Client) resolveScopePrincipals(ctx context.Context) error {
+	principalIDs := mapset.NewThreadUnsafeSet[string]()
+	allPrincipals := true
+	for _, s := range c.scopes {
+		if s.Principals.Empty() {
+			allPrincipals = false
+			continue
+		}
+		ids, err := c.resolvePrincipals(ctx, s)
+		if err != nil {
+			return err
+		}
+		s.principalIDs = ids
+		principalIDs.Append(ids...)
+	}
+	if allPrincipals {
+		c.principalIDs = principalIDs
+	}
+	return nil
+}
+
+// scopeMembershipBatchSize is the number of principals sent per request when checking which resources a scope
+// starting from principals selects.
+const scopeMembershipBatchSize = 100
+
+// matchScopes records on each resource of a page listed by the scope at index every scope that selects it, checking
+// the page's resources against the other scopes. A scope whose exclusions match a resource does not select it.
+// Resources an earlier scope selects are dropped from the page: that scope already listed them with the same scopes,
+// and a sync keeps the first copy of a resource.
+func (c *Client) matchScopes(ctx context.Context, index int, res *ResourceResponse) error {
+	var entities []GraphEntity
+	for _, n := range res.Data.GraphSearch.Nodes {
+		entities = append(entities, n.Entities...)
+	}
+	if len(entities) == 0 {
+		return nil
+	}
+
+	members := make([]mapset.Set[string], len(c.scopes))
+	for i, s := range c.scopes {
+		if i == index {
+			continue
+		}
+		m, err := c.scopeMembers(ctx, s, entities)
+		if err != nil {
+			return err
+		}
+		members[i] = m
+	}
+
+	for i, n := range res.Data.GraphSearch.Nodes {
+		kept := n.Entities[:0]
+		for _, e := range n.Entities {
+			var scopes []string
+			listedEarlier := false
+			for j, s := range c.scopes {
+				if j != index && (!members[j].Contains(e.Id) || s.exclusions.matchResource(&e)) {
+					continue
+				}
+				if j < index {
+					listedEarlier = true
+					break
+				}
+				if s.Name != "" {
+					scopes = append(scopes, s.Name)
+				}
+			}
+			if listedEarlier {
+				continue
+			}
+			e.Scopes = scopes
+			kept = append(kept, e)
+		}
+		res.Data.GraphSearch.Nodes[i].Entities = kept
+	}
+	return nil
+}
+
+// scopeMembers returns the ids of the entities the scope selects.
+func (c *Client) scopeMembers(ctx context.Context, s *Scope, entities []GraphEntity) (mapset.Set[string], error) {
+	members := mapset.NewThreadUnsafeSet[string]()
+	var candidates []string
+	for _, e := range entities {
+		if len(s.ResourceIDs) != 0 && !slices.Contains(s.ResourceIDs, e.Id) {
+			continue
+		}
+		// Graph searches filter on resource types themselves, principal access does not.
+		if s.principalIDs != nil && len(s.ResourceTypes) != 0 && !slices.Contains(s.ResourceTypes, e.Type) {
+			continue
+		}
+		candidates = append(candidates, e.Id)
+	}
+	if len(candidates) == 0 {
+		return members, nil
+	}
+
+	if s.principalIDs != nil {
+		for batch := range slices.Chunk(s.principalIDs, scopeMembershipBatchSize) {
+			after := ""
+			for depth := 0; ; depth++ {
+				variables := map[string]interface{}{
+					"first": DefaultPageSize,
+					"after": after,
+					"filterBy": map[string]interface{}{
+						"grantedEntity": map[string]interface{}{
+							"id": map[string]interface{}{"equals": batch},
+						},
+						"resource": map[string]interface{}{
+							"id": map[string]interface{}{"equals": candidates},
+						},
+					},
+				}
+				access := &PrincipalAccessResponse{}
+				err := c.doQuery(withPageDepth(ctx, depth), principalAccessQuery, variables, access)
+				if err != nil {
+					return nil, fmt.Errorf("wiz-connector: failed to match resources to scope %s: %w", s.Name, err)
+				}
+				for _, n := range access.Data.EntityEffectiveAccessEntries.Nodes {
+					if n.Resource != nil {
+						members.Add(n.Resource.Id)
+					}
+				}
+				if !access.Data.EntityEffectiveAccessEntries.PageInfo.HasNextPage {
+					break
+				}
+				after = access.Data.EntityEffectiveAccessEntries.PageInfo.EndCursor
+			}
+		}
+		return members, nil
+	}
+
+	after := ""
+	for depth := 0; ; depth++ {
+		res := &ResourceResponse{}
+		err := c.doQuery(withPageDepth(ctx, depth), buildResourceQuery(false), s.resourceSearchVariables(candidates, after), res)
+		if err != nil {
+			return nil, fmt.Errorf("wiz-connector: failed to match resources to scope %s: %w", s.Name, err)
+		}
+		for _, n := range res.Data.GraphSearch.Nodes {
+			for _, e := range n.Entities {
+				members.Add(e.Id)
+			}
+		}
+		if !res.Data.GraphSearch.PageInfo.HasNextPage {
+			return members, nil
+		}
+		after = res.Data.GraphSearch.PageInfo.EndCursor
+	}
+}
+
+// CloudScope selects resources by the cloud accounts they live in, the way operators think about them: AWS accounts,
+// Azure subscriptions and GCP projects, along with the cloud provider and region.
+type CloudScope struct {
+	// Providers are Wiz cloud platforms, e.g. AWS, Azure or GCP.
+	Providers []string
+	// AccountIDs are AWS account IDs, Azure subscription IDs or GCP project IDs.
+	AccountIDs []string
+	Regions    []string
+}
+
+// Empty reports whether the scope selects nothing, in which case resources are not filtered by cloud account.
+func (cs *CloudScope) Empty() bool {
+	return cs == nil || len(cs.Providers) == 0 && len(cs.AccountIDs) == 0 && len(cs.Regions) == 0
+}
+
+// apply adds the scope to the graph query. Providers and accounts filter on the subscription containing the
+// resource, regions on the resource itself.
+func (cs *CloudScope) apply(query map[string]interface{}) {
+	if cs.Empty() {
+		return
+	}
+
+	if len(cs.Regions) != 0 {
+		where := query["where"].(map[string]interface{})
+		where["region"] = map[string]interface{}{
+			"EQUALS": cs.Regions,
+		}
+	}
+
+	if len(cs.Providers) == 0 && len(cs.AccountIDs) == 0 {
+		return
+	}
+
+	subscriptionWhere := make(map[string]interface{})
+	if len(cs.Providers) != 0 {
+		subscriptionWhere["cloudPlatform"] = map[string]interface{}{
+			"EQUALS": cs.Providers,
+		}
+	}
+	if len(cs.AccountIDs) != 0 {
+		subscriptionWhere["externalId"] = map[string]interface{}{
+			"EQUALS": cs.AccountIDs,
+		}
+	}
+
+	query["relationships"] = []map[string]interface{}{{
+		"type": []map[string]interface{}{{"type": "CONTAINS", "reverse": true}},
+		"with": map[string]interface{}{
+			"type":  []string{"SUBSCRIPTION"},
+			"where": subscriptionWhere,
+		},
+	}}
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+)
+
+// scopeHandler answers graph searches with the resources whose ids are searched, and effective access queries with
+// two principals of the granted entity type, recording the types read for each resource.
+func scopeHandler(mu *sync.Mutex, types map[string][]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables struct {
+				Query *struct {
+					Where struct {
+						VertexID struct {
+							Equals []string `json:"EQUALS"`
+						} `json:"_vertexID"`
+					} `json:"where"`
+				} `json:"query"`
+				FilterBy struct {
+					GrantedEntityType struct {
+						Equals string `json:"equals"`
+					} `json:"grantedEntityType"`
+					Resource struct {
+						ID struct {
+							Equals []string `json:"equals"`
+						} `json:"id"`
+					} `json:"resource"`
+				} `json:"filterBy"`
+			} `json:"variables"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			http.Error(w, "unexpected query", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		if q := body.Variables.Query; q != nil {
+			res := &ResourceResponse{}
+			for _, id := range q.Where.VertexID.Equals {
+				res.Data.GraphSearch.Nodes = append(res.Data.GraphSearch.Nodes, GraphSearchNode{
+					Entities: []GraphEntity{{Id: id, Name: id, Type: "BUCKET"}},
+				})
+			}
+			_ = json.NewEncoder(w).Encode(res)
+			return
+		}
+
+		resourceID := body.Variables.FilterBy.Resource.ID.Equals[0]
+		gt := body.Variables.FilterBy.GrantedEntityType.Equals
+		mu.Lock()
+		types[resourceID] = append(types[resourceID], gt)
+		mu.Unlock()
+		res := &ResourcePermissions{}
+		for _, id := range []string{resourceID + "-" + gt, "excluded"} {
+			res.Data.EntityEffectiveAccessEntries.Nodes = append(res.Data.EntityEffectiveAccessEntries.Nodes, EffectiveAccessEntry{
+				GrantedEntity: &GrantedEntity{Id: id, Type: gt},
+				Permissions:   []string{"s3:GetObject"},
+			})
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}
+}
+
+func TestScopeSettings(t *testing.T) {
+	mu := &sync.Mutex{}
+	types := make(map[string][]string)
+	c := newTestClient(t, []*Scope{
+		{
+			Name:               "prod",
+			ResourceIDs:        []string{"r1", "r2"},
+			GrantedEntityTypes: []string{GrantedEntityTypeServiceAccount},
+			Exclusions:         &ExclusionRules{ResourceIDs: []string{"r2"}, PrincipalIDs: []string{"excluded"}},
+		},
+		{Name: "all", ResourceIDs: []string{"r2", "r3"}},
+	}, false, scopeHandler(mu, types))
+
+	listedBy := make(map[string]string)
+	token := &pagination.Token{}
+	for {
+		page, next, err := c.ListResources(context.Background(), token)
+		if err != nil {
+			t.Fatalf("ListResources() error = %v", err)
+		}
+		for _, n := range page.Data.GraphSearch.Nodes {
+			for _, e := range n.Entities {
+				listedBy[e.Id] = e.ListedBy()
+			}
+		}
+		if next == "" {
+			break
+		}
+		token = &pagination.Token{Token: next}
+	}
+	wantListedBy := map[string]string{"r1": "prod", "r2": "all", "r3": "all"}
+	if len(listedBy) != len(wantListedBy) {
+		t.Fatalf("listed resources %v, want %v", listedBy, wantListedBy)
+	}
+	for id, want := range wantListedBy {
+		if listedBy[id] != want {
+			t.Errorf("resource %s listed by %q, want %q, the scope excluding a resource leaves it to the others", id, listedBy[id], want)
+		}
+	}
+
+	tests := []struct {
+		resourceID     string
+		wantScope      string
+		wantTypes      []string
+		wantPrincipals []string
+	}{
+		{
+			resourceID:     "r1",
+			wantScope:      "prod",
+			wantTypes:      []string{GrantedEntityTypeUserAccount, GrantedEntityTypeServiceAccount},
+			wantPrincipals: []string{"r1-USER_ACCOUNT", "r1-SERVICE_ACCOUNT"},
+		},
+		{
+			resourceID:     "r2",
+			wantScope:      "all",
+			wantTypes:      []string{GrantedEntityTypeUserAccount},
+			wantPrincipals: []string{"r2-USER_ACCOUNT", "excluded"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resourceID, func(t *testing.T) {
+			var principals []string
+			token := &pagination.Token{}
+			for {
+				page, next, err := c.ListResourceEffectiveAccess(context.Background(), tt.resourceID, token)
+				if err != nil {
+					t.Fatalf("ListResourceEffectiveAccess() error = %v", err)
+				}
+				if page.Scope != tt.wantScope {
+					t.Errorf("page scope = %q, want %q", page.Scope, tt.wantScope)
+				}
+				for _, n := range page.Data.EntityEffectiveAccessEntries.Nodes {
+					principals = append(principals, n.GrantedEntity.Id)
+				}
+				if next == "" {
+					break
+				}
+				token = &pagination.Token{Token: next}
+			}
+			mu.Lock()
+			gotTypes := slices.Clone(types[tt.resourceID])
+			mu.Unlock()
+			slices.Sort(gotTypes)
+			wantTypes := slices.Sorted(slices.Values(tt.wantTypes))
+			if !slices.Equal(gotTypes, wantTypes) {
+				t.Errorf("granted entity types read = %v, want %v", gotTypes, wantTypes)
+			}
+			slices.Sort(principals)
+			wantPrincipals := slices.Sorted(slices.Values(tt.wantPrincipals))
+			if !slices.Equal(principals, wantPrincipals) {
+				t.Errorf("principals = %v, want %v", principals, wantPrincipals)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const IssueTypeToxicCombination = "TOXIC_COMBINATION"
+
+// issuesQueryTemplate is completed with any optional issue fields, see buildIssuesQuery.
+const issuesQueryTemplate = `query IssuesTable($filterBy: IssueFilters, $first: Int, $after: String) {
+  issues: issuesV2(filterBy: $filterBy, first: $first, after: $after) {
+    nodes {
+      id
+      severity
+      type
+      status
+      entitySnapshot {
+        id%s
+      }%s
+    }
+    pageInfo {
+      hasNextPage
+      endCursor
+    }
+  }
+}`
+
+// issueEntityFields describe the affected entity of an issue synced as a resource.
+const issueEntityFields = `
+        name
+        type
+        nativeType
+        cloudPlatform`
+
+// issueDetailsFields request what reviewers need to triage an issue synced as a resource: its control, projects, due
+// date and assignee.
+const issueDetailsFields = `
+      createdAt
+      dueAt
+      sourceRule {
+        id
+        name
+      }
+      projects {
+        id
+        name
+      }
+      assignee {
+        id
+        name
+        email
+      }`
+
+func buildIssuesQuery(includeDetails bool) string {
+	if includeDetails {
+		return fmt.Sprintf(issuesQueryTemplate, issueEntityFields, issueDetailsFields)
+	}
+	return fmt.Sprintf(issuesQueryTemplate, "", "")
+}
+
+var (
+	issuesQuery       = buildIssuesQuery(false)
+	issueDetailsQuery = buildIssuesQuery(true)
+)
+
+const vulnerabilityFindingsQuery = `query VulnerabilityFindingsTable($filterBy: VulnerabilityFindingFilters, $first: Int, $after: String) {
+  vulnerabilityFindings(filterBy: $filterBy, first: $first, after: $after) {
+    nodes {
+      id
+      severity
+      vulnerableAsset {
+        ... on VulnerableAssetBase {
+          id
+        }
+      }
+    }
+    pageInfo {
+      hasNextPage
+      endCursor
+    }
+  }
+}`
+
+const dataFindingsQuery = `query DataFindingsTable($filterBy: DataFindingFiltersV2, $first: Int, $after: String) {
+  dataFindingsV2(filterBy: $filterBy, first: $first, after: $after) {
+    nodes {
+      id
+      severity
+      dataClassifier {
+        id
+        name
+        category
+      }
+      graphEntity {
+        id
+      }
+    }
+    pageInfo {
+      hasNextPage
+      endCursor
+    }
+  }
+}`
+
+// openIssueStatuses are the issue statuses reviewers still need to act on.
+var openIssueStatuses = []string{"OPEN", "IN_PROGRESS"}
+
+// ListOpenIssuesForEntities returns every open issue related to any of the entities, walking all pages.
+func (c *Client) ListOpenIssuesForEntities(ctx context.Context, entityIDs []string) ([]*Issue, error) {
+	var issues []*Issue
+	after := ""
+	for depth := 0; ; depth++ {
+		variables := map[string]interface{}{
+			"first": DefaultPageSize,
+			"after": after,
+			"filterBy": map[string]interface{}{
+				"relatedEntity": map[string]interface{}{
+					"ids": entityIDs,
+				},
+				"status": openIssueStatuses,
+			},
+		}
+
+		res := &IssuesResponse{}
+		err := c.doQuery(withPageDepth(ctx, depth), issuesQuery, variables, res)
+		if err != nil {
+			return nil, fmt.Errorf("wiz-connector: failed to list issues: %w", err)
+		}
+
+		issues = append(issues, res.Data.Issues.Nodes...)
+		if !res.Data.Issues.PageInfo.HasNextPage {
+			return issues, nil
+		}
+		after = res.Data.Issues.PageInfo.EndCursor
+	}
+}
+
+// ListIssuesForEntity returns a page of the open issues affecting the entity, with the details needed to review them.
+func (c *Client) ListIssuesForEntity(ctx context.Context, entityID string, pToken *pagination.Token) ([]*Issue, string, error) {
+	cursor, err := parsePageCursor(pToken.Token)
+	if err != nil {
+		return nil, "", fmt.Errorf("wiz-connector: error parsing issues page token: %w", err)
+	}
+
+	variables := map[string]interface{}{
+		"first": DefaultPageSize,
+		"after": cursor.Cursor,
+		"filterBy": map[string]interface{}{
+			"relatedEntity": map[string]interface{}{
+				"ids": []string{entityID},
+			},
+			"status": openIssueStatuses,
+		},
+	}
+
+	res := &IssuesResponse{}
+	err = c.doQuery(withPageDepth(ctx, cursor.Depth), issueDetailsQuery, variables, res)
+	if err != nil {
+		return nil, "", fmt.Errorf("wiz-connector: failed to list issues for entity %s: %w", entityID, err)
+	}
+
+	nextPageToken, err := cursor.next(res.Data.Issues.PageInfo)
+	if err != nil {
+		return nil, "", err
+	}
+	return res.Data.Issues.Nodes, nextPageToken, nil
+}
+
+// ListCriticalVulnerabilitiesForAssets returns every open critical vulnerability finding on any of the assets,
+// walking all pages.
+func (c *Client) ListCriticalVulnerabilitiesForAssets(ctx context.Context, assetIDs []string) ([]*VulnerabilityFinding, error) {
+	var findings []*VulnerabilityFinding
+	after := ""
+	for depth := 0; ; depth++ {
+		variables := map[string]interface{}{
+			"first": DefaultPageSize,
+			"after": after,
+			"filterBy": map[string]interface{}{
+				"assetId":  assetIDs,
+				"severity": []string{"CRITICAL"},
+				"status":   []string{"OPEN"},
+			},
+		}
+
+		res := &VulnerabilityFindingsResponse{}
+		err := c.doQuery(withPageDepth(ctx, depth), vulnerabilityFindingsQuery, variables, res)
+		if err != nil {
+			return nil, fmt.Errorf("wiz-connector: failed to list vulnerability findings: %w", err)
+		}
+
+		findings = append(findings, res.Data.VulnerabilityFindings.Nodes...)
+		if !res.Data.VulnerabilityFindings.PageInfo.HasNextPage {
+			return findings, nil
+		}
+		after = res.Data.VulnerabilityFindings.PageInfo.EndCursor
+	}
+}
+
+// ListDataFindingsForEntities returns every data finding on any of the entities, walking all pages.
+func (c *Client) ListDataFindingsForEntities(ctx context.Context, entityIDs []string) ([]*DataFinding, error) {
+	var findings []*DataFinding
+	after := ""
+	for depth := 0; ; depth++ {
+		variables := map[string]interface{}{
+			"first": DefaultPageSize,
+			"after": after,
+			"filterBy": map[string]interface{}{
+				"graphEntityId": entityIDs,
+			},
+		}
+
+		res := &DataFindingsResponse{}
+		err := c.doQuery(withPageDepth(ctx, depth), dataFindingsQuery, variables, res)
+		if err != nil {
+			return nil, fmt.Errorf("wiz-connector: failed to list data findings: %w", err)
+		}
+
+		findings = append(findings, res.Data.DataFindings.Nodes...)
+		if !res.Data.DataFindings.PageInfo.HasNextPage {
+			return findings, nil
+		}
+		after = res.Data.DataFindings.PageInfo.EndCursor
+	}
+}
+
+// doQuery posts the GraphQL query to the Wiz API and decodes the response into res. Every request is traced as a span
+// named after the GraphQL operation.
+func (c *Client) doQuery(ctx context.Context, query string, variables map[string]interface{}, res interface{}) (err error) {
+	l := ctxzap.Extract(ctx)
+
+	payload := map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	}
+
+	accessToken, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, op := c.startOperation(ctx, operationName(query), variables)
+	defer func() { c.endOperation(ctx, op, err) }()
+
+	options := []uhttp.RequestOption{
+		uhttp.WithAcceptJSONHeader(),
+		uhttp.WithJSONBody(payload),
+		WithBearerToken(accessToken),
+	}
+
+	req, err := c.baseHttpClient.NewRequest(ctx, http.MethodPost, c.BaseUrl, options...)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.baseHttpClient.Do(req, uhttp.WithJSONResponse(res), op.responseOption())
+	if err != nil {
+		l.Error("wiz-connector: graphql query failed", zap.String("operation", op.name), zap.Any("variables", variables), zap.Error(err))
+		return err
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestListDataFindingsForEntities(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/data_findings.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotEntityIDs []string
+	c := newTestClient(t, []*Scope{{ResourceIDs: []string{"bucket-1"}}}, false, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables struct {
+				FilterBy struct {
+					GraphEntityID []string `json:"graphEntityId"`
+				} `json:"filterBy"`
+			} `json:"variables"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		gotEntityIDs = body.Variables.FilterBy.GraphEntityID
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(fixture)
+	})
+
+	findings, err := c.ListDataFindingsForEntities(context.Background(), []string{"bucket-1", "database-1"})
+	if err != nil {
+		t.Fatalf("ListDataFindingsForEntities() error = %v", err)
+	}
+	if !slices.Equal(gotEntityIDs, []string{"bucket-1", "database-1"}) {
+		t.Errorf("data findings were filtered by entities %q, want both resources", gotEntityIDs)
+	}
+
+	var got [][2]string
+	for _, f := range findings {
+		got = append(got, [2]string{f.GraphEntity.Id, f.DataClassifier.Category})
+	}
+	want := [][2]string{{"bucket-1", "PII"}, {"bucket-1", "SECRETS"}, {"database-1", "PCI"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("ListDataFindingsForEntities() entities and categories = %q, want %q", got, want)
+	}
+}
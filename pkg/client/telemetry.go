@@ -0,0 +1,230 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/conductorone/baton-wiz/pkg/client"
+
+	// tokenOperation names the OAuth token request among the GraphQL operations.
+	tokenOperation = "OAuthToken"
+)
+
+var (
+	tracer = otel.Tracer(instrumentationName)
+	meter  = otel.Meter(instrumentationName)
+
+	// Instruments fall back to no-ops when they cannot be created, telemetry never fails a sync.
+	requestCounter, _   = meter.Int64Counter("wiz.api.requests", metric.WithDescription("Wiz API requests by operation and outcome"))
+	requestDuration, _  = meter.Float64Histogram("wiz.api.duration", metric.WithDescription("Latency of Wiz API requests"), metric.WithUnit("s"))
+	throttledCounter, _ = meter.Int64Counter("wiz.api.throttled", metric.WithDescription("Wiz API requests rejected by rate limiting"))
+	entityCounter, _    = meter.Int64Counter("wiz.entities.fetched", metric.WithDescription("Entities returned by Wiz API operations"))
+
+	operationNamePattern = regexp.MustCompile(`^\s*(?:query|mutation)\s+(\w+)`)
+)
+
+type pageDepthKey struct{}
+
+// withPageDepth records how many pages into a walk the request made with the context is, so its span can tell the
+// first page of a walk from the hundredth. Walks spanning several sync pages carry the depth in their page token.
+func withPageDepth(ctx context.Context, depth int) context.Context {
+	return context.WithValue(ctx, pageDepthKey{}, depth)
+}
+
+func pageDepth(ctx context.Context) int {
+	depth, _ := ctx.Value(pageDepthKey{}).(int)
+	return depth
+}
+
+// pageCursor is a Wiz cursor kept in a page token, along with the number of pages walked to reach it.
+type pageCursor struct {
+	Cursor string `json:"cursor"`
+	Depth  int    `json:"depth,omitempty"`
+}
+
+// parsePageCursor reads the cursor of a page token, the first page when the token is empty.
+func parsePageCursor(token string) (*pageCursor, error) {
+	pc := &pageCursor{}
+	if token == "" {
+		return pc, nil
+	}
+	err := json.Unmarshal([]byte(token), pc)
+	if err != nil {
+		return nil, err
+	}
+	return pc, nil
+}
+
+// next returns the page token following the page at the cursor, empty after the last page.
+func (pc *pageCursor) next(pageInfo PageInfo) (string, error) {
+	if !pageInfo.HasNextPage {
+		return "", nil
+	}
+	data, err := json.Marshal(&pageCursor{Cursor: pageInfo.EndCursor, Depth: pc.Depth + 1})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// graphQLResult is the part of any Wiz GraphQL response telemetry reads: the connection of the single root field and
+// the errors.
+type graphQLResult struct {
+	Data map[string]struct {
+		Nodes    []json.RawMessage `json:"nodes"`
+		PageInfo PageInfo          `json:"pageInfo"`
+	} `json:"data"`
+	Errors []struct {
+		Message    string `json:"message"`
+		Extensions struct {
+			Code string `json:"code"`
+		} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// apiCalls counts the requests made by a client, for the sync report.
+type apiCalls struct {
+	mtx         sync.Mutex
+	byOperation map[string]int
+	throttled   int
+}
+
+// APICallCounts returns the number of requests made per operation and how many of them were throttled.
+func (c *Client) APICallCounts() (map[string]int, int) {
+	c.apiCalls.mtx.Lock()
+	defer c.apiCalls.mtx.Unlock()
+	return maps.Clone(c.apiCalls.byOperation), c.apiCalls.throttled
+}
+
+// ResetCounts clears the API call and exclusion counts, so that the counts of a sync do not include earlier syncs
+// run by the same process.
+func (c *Client) ResetCounts() {
+	c.apiCalls.mtx.Lock()
+	clear(c.apiCalls.byOperation)
+	c.apiCalls.throttled = 0
+	c.apiCalls.mtx.Unlock()
+
+	c.exclusions.resourcesSeen.Clear()
+	c.exclusions.principalsSeen.Clear()
+}
+
+// operation is a single Wiz API call being traced.
+type operation struct {
+	name       string
+	span       trace.Span
+	start      time.Time
+	depth      int
+	statusCode int
+	results    int
+	endCursor  string
+	errorCodes []string
+}
+
+func operationName(query string) string {
+	m := operationNamePattern.FindStringSubmatch(query)
+	if m == nil {
+		return "unknown"
+	}
+	return m[1]
+}
+
+// startOperation starts the span of a request to the Wiz API.
+func (c *Client) startOperation(ctx context.Context, name string, variables map[string]interface{}) (context.Context, *operation) {
+	op := &operation{
+		name:  name,
+		start: time.Now(),
+	}
+
+	attrs := []attribute.KeyValue{attribute.String("graphql.operation.name", op.name)}
+	if first, ok := variables["first"].(int); ok {
+		attrs = append(attrs, attribute.Int("wiz.page_size", first))
+	}
+	op.depth = pageDepth(ctx)
+	attrs = append(attrs, attribute.Int("wiz.cursor_depth", op.depth))
+
+	ctx, op.span = tracer.Start(ctx, "wiz.api "+op.name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx, op
+}
+
+// responseOption reads the status, result count, cursor and GraphQL errors of the response.
+func (op *operation) responseOption() uhttp.DoOption {
+	return func(resp *uhttp.WrapperResponse) error {
+		op.statusCode = resp.StatusCode
+		res := &graphQLResult{}
+		if json.Unmarshal(resp.Body, res) != nil {
+			return nil
+		}
+		for _, conn := range res.Data {
+			op.results += len(conn.Nodes)
+			if conn.PageInfo.HasNextPage {
+				op.endCursor = conn.PageInfo.EndCursor
+			}
+		}
+		for _, e := range res.Errors {
+			code := e.Extensions.Code
+			if code == "" {
+				code = "UNKNOWN"
+			}
+			op.errorCodes = append(op.errorCodes, code)
+		}
+		return nil
+	}
+}
+
+// endOperation records the outcome of the request on the span and in the metrics.
+func (c *Client) endOperation(ctx context.Context, op *operation, err error) {
+	defer op.span.End()
+
+	outcome := "ok"
+	switch {
+	case op.statusCode == http.StatusTooManyRequests:
+		outcome = "throttled"
+		throttledCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("graphql.operation.name", op.name)))
+	case err != nil || len(op.errorCodes) != 0:
+		outcome = "error"
+	}
+
+	c.apiCalls.mtx.Lock()
+	c.apiCalls.byOperation[op.name]++
+	if outcome == "throttled" {
+		c.apiCalls.throttled++
+	}
+	c.apiCalls.mtx.Unlock()
+
+	op.span.SetAttributes(
+		attribute.Int("http.response.status_code", op.statusCode),
+		attribute.Int("wiz.result_count", op.results),
+		attribute.Bool("wiz.has_next_page", op.endCursor != ""),
+	)
+	if len(op.errorCodes) != 0 {
+		op.span.SetAttributes(attribute.StringSlice("graphql.error.codes", op.errorCodes))
+	}
+	if err != nil {
+		op.span.RecordError(err)
+		op.span.SetStatus(codes.Error, err.Error())
+	} else if len(op.errorCodes) != 0 {
+		op.span.SetStatus(codes.Error, "graphql errors")
+	}
+
+	attrs := metric.WithAttributes(
+		attribute.String("graphql.operation.name", op.name),
+		attribute.String("outcome", outcome),
+	)
+	requestCounter.Add(ctx, 1, attrs)
+	requestDuration.Record(ctx, time.Since(op.start).Seconds(), attrs)
+	entityCounter.Add(ctx, int64(op.results), metric.WithAttributes(attribute.String("graphql.operation.name", op.name)))
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/conductorone/baton-sdk/pkg/sdk"
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TransportOptions configure how the client reaches Wiz, for both the token and GraphQL calls.
+type TransportOptions struct {
+	// ProxyURL is the HTTP(S) proxy for Wiz calls. Without one, the HTTPS_PROXY and NO_PROXY environment is used.
+	ProxyURL string
+	// CACertFiles are PEM files with certificates trusted in addition to the system roots, such as a proxy's CA.
+	CACertFiles []string
+	// ClientCertFile and ClientKeyFile are the PEM certificate and key presented for mutual TLS.
+	ClientCertFile string
+	ClientKeyFile  string
+	// TLSMinVersion is 1.2 or 1.3. Defaults to 1.2.
+	TLSMinVersion string
+}
+
+func (o *TransportOptions) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if o.TLSMinVersion != "" {
+		version, ok := tlsVersions[o.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("wiz-connector: invalid TLS minimum version %q, must be 1.2 or 1.3", o.TLSMinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	if len(o.CACertFiles) != 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, path := range o.CACertFiles {
+			pem, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("wiz-connector: error reading CA certificate file: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("wiz-connector: no certificates found in CA certificate file %s", path)
+			}
+		}
+		config.RootCAs = pool
+	}
+
+	if o.ClientCertFile != "" || o.ClientKeyFile != "" {
+		if o.ClientCertFile == "" || o.ClientKeyFile == "" {
+			return nil, fmt.Errorf("wiz-connector: a client certificate and key are both required for mutual TLS")
+		}
+		cert, err := tls.LoadX509KeyPair(o.ClientCertFile, o.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("wiz-connector: error loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// newHTTPClient builds the HTTP client for Wiz calls.
+func newHTTPClient(ctx context.Context, options *TransportOptions) (*http.Client, error) {
+	l := ctxzap.Extract(ctx)
+	if options == nil {
+		options = &TransportOptions{}
+	}
+
+	tlsConfig, err := options.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := uhttp.NewClient(ctx, uhttp.WithLogger(true, l), uhttp.WithTLSClientConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+
+	if options.ProxyURL == "" {
+		return httpClient, nil
+	}
+
+	proxyURL, err := url.Parse(options.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("wiz-connector: error parsing proxy url: %w", err)
+	}
+	httpClient.Transport = newProxyTransport(proxyURL, tlsConfig, l)
+	return httpClient, nil
+}
+
+// proxyTransport carries Wiz calls through an explicit proxy. The uhttp transport only reads proxies from the
+// environment and cannot be given one, so this one is set up the same way: HTTP/2, the same timeouts, the baton user
+// agent and request logging.
+type proxyTransport struct {
+	next      http.RoundTripper
+	userAgent string
+	logger    *zap.Logger
+}
+
+func newProxyTransport(proxyURL *url.URL, tlsConfig *tls.Config, logger *zap.Logger) *proxyTransport {
+	return &proxyTransport{
+		next: &http.Transport{
+			Proxy: http.ProxyURL(proxyURL),
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			TLSClientConfig:       tlsConfig,
+		},
+		userAgent: "baton-sdk/" + sdk.Version,
+		logger:    logger,
+	}
+}
+
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+
+	fields := []zap.Field{
+		zap.String("http.method", req.Method),
+		zap.String("http.url_details.host", req.URL.Host),
+		zap.String("http.url_details.path", req.URL.Path),
+	}
+	t.logger.Debug("Request started", fields...)
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	if resp != nil {
+		fields = append(fields, zap.Int("http.status_code", resp.StatusCode))
+	}
+	t.logger.Debug("Request complete", fields...)
+	return resp, err
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewHTTPClientProxy(t *testing.T) {
+	var gotURL, gotUserAgent string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURL = r.URL.String()
+		gotUserAgent = r.Header.Get("User-Agent")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	httpClient, err := newHTTPClient(context.Background(), &TransportOptions{ProxyURL: proxy.URL})
+	if err != nil {
+		t.Fatalf("newHTTPClient() error = %v", err)
+	}
+	resp, err := httpClient.Get("http://wiz.invalid/graphql")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if gotURL != "http://wiz.invalid/graphql" {
+		t.Errorf("proxy received %q, want the request for http://wiz.invalid/graphql", gotURL)
+	}
+	if !strings.HasPrefix(gotUserAgent, "baton-sdk/") {
+		t.Errorf("User-Agent = %q, want the baton user agent", gotUserAgent)
+	}
+}
+
+func TestTransportOptionsTLSConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		options TransportOptions
+		wantErr bool
+	}{
+		{name: "defaults", options: TransportOptions{}},
+		{name: "tls 1.3", options: TransportOptions{TLSMinVersion: "1.3"}},
+		{name: "invalid tls version", options: TransportOptions{TLSMinVersion: "1.1"}, wantErr: true},
+		{name: "missing ca file", options: TransportOptions{CACertFiles: []string{"/nonexistent/ca.pem"}}, wantErr: true},
+		{name: "certificate without key", options: TransportOptions{ClientCertFile: "cert.pem"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.options.tlsConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tlsConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
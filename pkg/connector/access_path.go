@@ -0,0 +1,94 @@
+package connector
+
+import (
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-wiz/pkg/client"
+)
+
+// accessPathStepKind labels a hop of an access path for reviewers.
+func accessPathStepKind(entityType string) string {
+	switch entityType {
+	case client.GrantedEntityTypeGroup:
+		return "group"
+	case client.AccessPathEntityTypeAccessRole:
+		return "role"
+	case client.AccessPathEntityTypeAccessRoleBinding:
+		return "role binding"
+	case client.AccessPathEntityTypeRawAccessPolicy:
+		return "policy"
+	default:
+		return strings.ToLower(strings.ReplaceAll(entityType, "_", " "))
+	}
+}
+
+// accessPathMetadata explains why the granted entity has access to the resource. It returns nil when Wiz did not
+// return an access path for the entry.
+//
+// The human readable path reads like "alice -> group Admins -> role Admin -> policy AdministratorAccess -> bucket",
+// and the groups, roles and policies are listed separately so reviewers can find the policy to change. More than one
+// role on the path is an assumed role chain.
+func accessPathMetadata(grantedEntity *client.GrantedEntity, path []*client.AccessPathEntity, resource *v2.Resource) map[string]interface{} {
+	if len(path) == 0 {
+		return nil
+	}
+
+	steps := make([]interface{}, 0, len(path))
+	var groups, roles, roleBindings, policies []interface{}
+	for _, step := range path {
+		steps = append(steps, map[string]interface{}{
+			"id":          step.Id,
+			"name":        step.Name,
+			"type":        step.Type,
+			"kind":        accessPathStepKind(step.Type),
+			"native_type": step.Properties.NativeType,
+		})
+
+		switch step.Type {
+		case client.GrantedEntityTypeGroup:
+			groups = append(groups, step.Name)
+		case client.AccessPathEntityTypeAccessRole:
+			roles = append(roles, step.Name)
+		case client.AccessPathEntityTypeAccessRoleBinding:
+			roleBindings = append(roleBindings, step.Name)
+		case client.AccessPathEntityTypeRawAccessPolicy:
+			policies = append(policies, step.Name)
+		}
+	}
+
+	metadata := map[string]interface{}{
+		GrantMetadataAccessPath:        steps,
+		GrantMetadataAccessPathSummary: accessPathSummary(grantedEntity, path, resource.DisplayName),
+	}
+	if len(groups) != 0 {
+		metadata[GrantMetadataGroups] = groups
+	}
+	if len(roles) != 0 {
+		metadata[GrantMetadataRoles] = roles
+	}
+	if len(roles) > 1 {
+		metadata[GrantMetadataAssumedRoleChain] = roles
+	}
+	if len(roleBindings) != 0 {
+		metadata[GrantMetadataRoleBindings] = roleBindings
+	}
+	if len(policies) != 0 {
+		metadata[GrantMetadataPolicies] = policies
+	}
+	return metadata
+}
+
+// accessPathSummary returns the human readable access path, or an empty string when Wiz did not return one.
+func accessPathSummary(grantedEntity *client.GrantedEntity, path []*client.AccessPathEntity, resourceName string) string {
+	if len(path) == 0 {
+		return ""
+	}
+	summary := make([]string, 0, len(path)+2)
+	summary = append(summary, grantedEntity.Name)
+	for _, step := range path {
+		summary = append(summary, accessPathStepKind(step.Type)+" "+step.Name)
+	}
+	summary = append(summary, resourceName)
+	return strings.Join(summary, " -> ")
+}
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"time"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
@@ -18,34 +20,95 @@ import (
 var resourceTagErr = errors.New(`error parsing resource tags, format should be [{"key":"key1","val":"val1"}, {"key":"key2","val":"val2"}]`)
 
 type Config struct {
-	ClientID            string
-	ClientSecret        string
-	EndpointURL         string
-	AuthURL             string
-	Audience            string
-	ResourceIDs         []string
-	ResourceTags        string
-	ResourceTypes       []string
-	SyncIdentities      bool
-	SyncServiceAccounts bool
-	ExternalSyncMode    bool
-	ProjectID           string
+	ClientID     string
+	ClientSecret string
+	// ClientSecretFile is read every time the access token is refreshed, "-" reads the secret from stdin once.
+	ClientSecretFile string
+	// ClientSecretCommand is run every time the access token is refreshed and prints the secret.
+	ClientSecretCommand string
+	// Credentials, when set, provides the client secret instead of the other client secret fields.
+	Credentials               client.CredentialSource
+	EndpointURL               string
+	AuthURL                   string
+	Audience                  string
+	Region                    string
+	Environment               string
+	AuthProvider              string
+	ProxyURL                  string
+	CACertFiles               []string
+	TLSClientCertFile         string
+	TLSClientKeyFile          string
+	TLSMinVersion             string
+	ResourceIDs               []string
+	ResourceTags              string
+	ResourceTypes             []string
+	SyncIdentities            bool
+	SyncServiceAccounts       bool
+	ExternalSyncMode          bool
+	ProjectID                 string
+	IdentityStrategies        []string
+	IdentityMappingFile       string
+	CorrelateIdentities       bool
+	IncludeAccessPaths        bool
+	SyncRoles                 bool
+	NormalizeAccessLevels     bool
+	AccessTaxonomyFile        string
+	MarkSensitiveEntitlements bool
+	EnrichSecurityContext     bool
+	SyncIssues                bool
+	// Principal emails, group ids and identity providers select the principals an identity-centric sync starts
+	// from, instead of resource ids or tags.
+	PrincipalEmails            []string
+	PrincipalGroupIDs          []string
+	PrincipalIdentityProviders []string
+	// Cloud providers, account ids and regions select resources by the cloud accounts they live in, alone or
+	// combined with tags and resource types.
+	CloudProviders  []string
+	CloudAccountIDs []string
+	CloudRegions    []string
+	// Exclusions drop noisy resources and principals, see client.ExclusionRules.
+	ExcludeResourceIDs           []string
+	ExcludeResourceNamePatterns  []string
+	ExcludeResourceTags          string
+	ExcludePrincipalIDs          []string
+	ExcludePrincipalNamePatterns []string
+	ExcludeNativeTypes           []string
+	ExcludeCloudProviders        []string
+	// ResourceTypeMapping maps Wiz entity types to the label used in resource display names.
+	ResourceTypeMapping map[string]string
+	// ConfigFile is a sync profile read when the connector is created. Every scope it declares is synced, or only
+	// ConfigScope when set.
+	ConfigFile  string
+	ConfigScope string
+	// SyncReportFile is where the JSON summary of the sync is written.
+	SyncReportFile string
+	// IncrementalSync carries the entitlements and grants of resources unchanged since the last sync over from the
+	// previous sync in PreviousSyncFile, see incrementalSync. IncrementalStateFile records when the last sync started,
+	// and FullSyncInterval forces a full sync once the last one is older, never when zero.
+	IncrementalSync      bool
+	IncrementalStateFile string
+	PreviousSyncFile     string
+	FullSyncInterval     time.Duration
+	// Export creates a connector that reads effective access for an export rather than a sync, see EffectiveAccess.
+	Export bool
 }
 
 type Connector struct {
-	Client *client.Client
-	Config *Config
+	// Client is the client of the first tenant.
+	Client      *client.Client
+	Config      *Config
+	tenants     []*tenant
+	report      *syncReport
+	incremental *incrementalSync
 }
 
 // ResourceSyncers returns a ResourceSyncer for each resource type that should be synced from the upstream service.
+// With several tenants, every resource type is synced from each of them under a tenant resource.
 func (d *Connector) ResourceSyncers(ctx context.Context) []connectorbuilder.ResourceSyncer {
-	resourceSyncers := []connectorbuilder.ResourceSyncer{
-		newResourceBuilder(d.Client, d.Config.ExternalSyncMode),
+	if len(d.tenants) == 1 && d.tenants[0].name == "" {
+		return newTracedSyncers(ctx, d.incremental.wrap(ctx, d.tenants[0].resourceSyncers()), d.report)
 	}
-	if !d.Config.ExternalSyncMode {
-		resourceSyncers = append(resourceSyncers, newUserBuilder(d.Client))
-	}
-	return resourceSyncers
+	return newTracedSyncers(ctx, d.incremental.wrap(ctx, newTenantSyncers(ctx, d.tenants)), d.report)
 }
 
 // Asset takes an input AssetRef and attempts to fetch it using the connector's authenticated http client
@@ -63,50 +126,278 @@ func (d *Connector) Metadata(ctx context.Context) (*v2.ConnectorMetadata, error)
 }
 
 // Validate is called to ensure that the connector is properly configured. It should exercise any API credentials
-// to be sure that they are valid.
+// to be sure that they are valid. The syncer validates the connector at the start of every sync, which starts a new
+// sync report and drops the effective access cached by an earlier sync.
 func (d *Connector) Validate(ctx context.Context) (annotations.Annotations, error) {
-	err := d.Client.Authorize(ctx, d.Config.AuthURL, d.Config.ClientID, d.Config.ClientSecret, d.Config.Audience)
-	if err != nil {
-		return nil, fmt.Errorf("wiz-connector: error authorizing: %w", err)
+	d.report.reset()
+	for _, t := range d.tenants {
+		err := t.client.ClearEffectiveAccessCache()
+		if err != nil {
+			return nil, err
+		}
+		err = t.client.Reauthorize(ctx)
+		if err != nil {
+			if t.name != "" {
+				return nil, fmt.Errorf("wiz-connector: error authorizing tenant %q: %w", t.name, err)
+			}
+			return nil, fmt.Errorf("wiz-connector: error authorizing: %w", err)
+		}
 	}
 	return nil, nil
 }
 
+// FinishSync writes the sync report, when one was requested, and the incremental sync state once the sync has
+// completed, then removes the effective access cached during the sync.
+func (d *Connector) FinishSync(ctx context.Context) {
+	d.report.write(ctx, reportStatusCompleted)
+	d.incremental.finish(ctx)
+	for _, t := range d.tenants {
+		err := t.client.ClearEffectiveAccessCache()
+		if err != nil {
+			ctxzap.Extract(ctx).Warn("wiz-connector: failed to remove the effective access cache", zap.Error(err))
+		}
+	}
+}
+
 // New returns a new instance of the connector.
 func New(ctx context.Context, config *Config) (*Connector, error) {
 	l := ctxzap.Extract(ctx)
-	var resourceTags []*client.ResourceTag
 
-	if config.ResourceTags != "" {
-		err := json.Unmarshal([]byte(config.ResourceTags), &resourceTags)
+	var profileScopes []*ProfileScope
+	var profileTenants []*ProfileTenant
+	if config.ConfigFile != "" {
+		profile, err := LoadSyncProfile(config.ConfigFile)
 		if err != nil {
-			return nil, resourceTagErr
+			return nil, err
+		}
+		profileScopes, err = profile.Select(config.ConfigScope)
+		if err != nil {
+			return nil, err
 		}
+		profileTenants = profile.Tenants
 	}
 
-	for _, rt := range resourceTags {
-		if rt.Key == "" || rt.Value == "" {
-			return nil, resourceTagErr
+	flagScope, err := newFlagScope(config)
+	if err != nil {
+		return nil, err
+	}
+
+	excludeTags, err := parseResourceTags(config.ExcludeResourceTags)
+	if err != nil {
+		return nil, err
+	}
+
+	// The access level rules normalize entitlements and classify the privilege of marked ones.
+	var taxonomy, classifier *accessTaxonomy
+	if config.NormalizeAccessLevels || config.MarkSensitiveEntitlements {
+		classifier, err = newAccessTaxonomy(config.AccessTaxonomyFile)
+		if err != nil {
+			return nil, err
 		}
+	} else if config.AccessTaxonomyFile != "" {
+		return nil, errors.New("wiz-connector: an access taxonomy file requires normalizing access levels or marking sensitive entitlements")
+	}
+	if config.NormalizeAccessLevels {
+		taxonomy = classifier
 	}
 
-	cli, err := client.New(ctx,
-		config.ClientID,
-		config.ClientSecret,
-		config.Audience,
-		config.AuthURL,
-		config.EndpointURL,
-		config.ResourceIDs,
-		resourceTags,
-		config.ResourceTypes,
-		config.SyncIdentities,
-		config.SyncServiceAccounts,
-		config.ExternalSyncMode,
-		config.ProjectID)
+	exclusionRules := &client.ExclusionRules{
+		ResourceIDs:           config.ExcludeResourceIDs,
+		ResourceNamePatterns:  config.ExcludeResourceNamePatterns,
+		ResourceTags:          excludeTags,
+		PrincipalIDs:          config.ExcludePrincipalIDs,
+		PrincipalNamePatterns: config.ExcludePrincipalNamePatterns,
+		NativeTypes:           config.ExcludeNativeTypes,
+		Providers:             config.ExcludeCloudProviders,
+	}
+
+	tenantConfigs := map[string]*Config{"": config}
+	tenantNames := []string{""}
+	if len(profileTenants) != 0 {
+		tenantConfigs = make(map[string]*Config, len(profileTenants))
+		tenantNames = make([]string, 0, len(profileTenants))
+		for _, pt := range profileTenants {
+			tenantConfigs[pt.Name] = pt.config(config)
+			tenantNames = append(tenantNames, pt.Name)
+		}
+	}
+
+	report := newSyncReport(config.SyncReportFile)
+	stdin := &client.ReaderCredential{Reader: os.Stdin}
+	tenants := make([]*tenant, 0, len(tenantNames))
+	for _, name := range tenantNames {
+		scopes := []*client.Scope{flagScope}
+		var tenantScopes []*ProfileScope
+		if len(profileScopes) != 0 {
+			tenantScopes = tenantProfileScopes(profileScopes, name)
+			if len(tenantScopes) == 0 {
+				l.Info("wiz-connector: skipping tenant, no selected scope is synced from it", zap.String("tenant", name))
+				continue
+			}
+			scopes = make([]*client.Scope, 0, len(tenantScopes))
+			for _, ps := range tenantScopes {
+				scopes = append(scopes, ps.clientScope(flagScope))
+			}
+		}
+		tenantConfig := tenantConfigs[name]
+		credentials := credentialSource(tenantConfig, stdin)
+		if tenantConfig.ClientID == "" || credentials == nil {
+			if name != "" {
+				return nil, fmt.Errorf("wiz-connector: a client id and client secret are required for tenant %q, with flags or in the sync profile", name)
+			}
+			return nil, fmt.Errorf("wiz-connector: a client id and client secret are required")
+		}
+
+		identity, err := newIdentityResolver(tenantConfig.IdentityStrategies, tenantConfig.IdentityMappingFile)
+		if err != nil {
+			return nil, err
+		}
+		identity.report = report
+
+		endpoints := &client.Endpoints{
+			Region:       tenantConfig.Region,
+			Environment:  tenantConfig.Environment,
+			AuthProvider: tenantConfig.AuthProvider,
+			AuthURL:      tenantConfig.AuthURL,
+			EndpointURL:  tenantConfig.EndpointURL,
+			Audience:     tenantConfig.Audience,
+		}
+		cli, err := client.New(ctx,
+			tenantConfig.ClientID,
+			credentials,
+			endpoints,
+			&client.TransportOptions{
+				ProxyURL:       tenantConfig.ProxyURL,
+				CACertFiles:    tenantConfig.CACertFiles,
+				ClientCertFile: tenantConfig.TLSClientCertFile,
+				ClientKeyFile:  tenantConfig.TLSClientKeyFile,
+				TLSMinVersion:  tenantConfig.TLSMinVersion,
+			},
+			scopes,
+			tenantConfig.SyncIdentities,
+			tenantConfig.SyncServiceAccounts,
+			tenantConfig.ExternalSyncMode,
+			tenantConfig.IncludeAccessPaths,
+			tenantConfig.SyncRoles,
+			tenantConfig.MarkSensitiveEntitlements,
+			tenantConfig.EnrichSecurityContext,
+			tenantConfig.Export,
+			exclusionRules)
+		if err != nil {
+			l.Error("wiz-connector: failed to read token response", zap.String("tenant", name), zap.Error(err))
+			return nil, err
+		}
+		if tenantConfig.CorrelateIdentities && !tenantConfig.ExternalSyncMode {
+			identity.correlator = newIdentityCorrelator(cli)
+		}
+		err = identity.setScopes(tenantScopes, tenantConfig.IdentityMappingFile)
+		if err != nil {
+			return nil, err
+		}
+		tenantConfig.AuthURL = endpoints.AuthURL
+		tenantConfig.EndpointURL = endpoints.EndpointURL
+		tenantConfig.Audience = endpoints.Audience
+		l.Debug("wiz-connector: resolved tenant endpoints",
+			zap.String("tenant", name),
+			zap.String("endpoint_url", endpoints.EndpointURL),
+			zap.String("auth_url", endpoints.AuthURL),
+			zap.String("audience", endpoints.Audience),
+		)
+
+		tenants = append(tenants, &tenant{
+			name:          name,
+			config:        tenantConfig,
+			client:        cli,
+			identity:      identity,
+			typeMappings:  newResourceTypeMappings(tenantConfig.ResourceTypeMapping, tenantScopes),
+			taxonomy:      taxonomy,
+			classifier:    classifier,
+			profileScopes: tenantScopes,
+		})
+	}
+
+	if report != nil {
+		report.tenants = tenants
+	}
+
+	incremental, err := newIncrementalSync(ctx, config, tenants)
 	if err != nil {
-		l.Error("wiz-connector: failed to read token response", zap.Error(err))
 		return nil, err
 	}
 
-	return &Connector{Client: cli, Config: config}, nil
+	return &Connector{
+		Client:      tenants[0].client,
+		Config:      config,
+		tenants:     tenants,
+		report:      report,
+		incremental: incremental,
+	}, nil
+}
+
+// credentialSource returns where the client secret of the config comes from, or nil without one. Tenants reading
+// the secret from stdin share it.
+func credentialSource(config *Config, stdin *client.ReaderCredential) client.CredentialSource {
+	switch {
+	case config.Credentials != nil:
+		return config.Credentials
+	case config.ClientSecretCommand != "":
+		return &client.CommandCredential{Command: config.ClientSecretCommand}
+	case config.ClientSecretFile == "-":
+		return stdin
+	case config.ClientSecretFile != "":
+		return &client.FileCredential{Path: config.ClientSecretFile}
+	case config.ClientSecret != "":
+		return client.StaticCredential(config.ClientSecret)
+	default:
+		return nil
+	}
+}
+
+// newFlagScope builds the unnamed scope selected with flags.
+func newFlagScope(config *Config) (*client.Scope, error) {
+	resourceTags, err := parseResourceTags(config.ResourceTags)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := &client.Scope{
+		ResourceIDs:   config.ResourceIDs,
+		ResourceTags:  resourceTags,
+		ResourceTypes: config.ResourceTypes,
+		ProjectID:     config.ProjectID,
+		Principals: &client.PrincipalFilter{
+			Emails:            config.PrincipalEmails,
+			GroupIDs:          config.PrincipalGroupIDs,
+			IdentityProviders: config.PrincipalIdentityProviders,
+		},
+		Cloud: &client.CloudScope{
+			Providers:  config.CloudProviders,
+			AccountIDs: config.CloudAccountIDs,
+			Regions:    config.CloudRegions,
+		},
+	}
+	if !scope.Principals.Empty() && (len(scope.ResourceIDs) != 0 || len(scope.ResourceTags) != 0 || !scope.Cloud.Empty()) {
+		return nil, errors.New("wiz-connector: principals and resource ids, tags or cloud accounts cannot be used together, a sync starts from either principals or resources")
+	}
+	return scope, nil
+}
+
+// parseResourceTags parses a JSON list of resource tags, e.g. [{"key":"key1","val":"val1"}].
+func parseResourceTags(tags string) ([]*client.ResourceTag, error) {
+	if tags == "" {
+		return nil, nil
+	}
+
+	var resourceTags []*client.ResourceTag
+	err := json.Unmarshal([]byte(tags), &resourceTags)
+	if err != nil {
+		return nil, resourceTagErr
+	}
+
+	for _, rt := range resourceTags {
+		if rt.Key == "" || rt.Value == "" {
+			return nil, resourceTagErr
+		}
+	}
+	return resourceTags, nil
 }
@@ -0,0 +1,76 @@
+package connector
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/conductorone/baton-wiz/pkg/client"
+)
+
+// identityCorrelator groups the separate Wiz accounts of one human (Okta, AWS IAM Identity Center, Azure AD, GCP...)
+// into a single user. Accounts are only linked through keys stated explicitly: the identity provider subject a
+// federated account carries as its external id, which is its identity provider user's provider unique id, or a
+// canonical ID the identity mapping file assigns. Sharing an email does not link accounts, and links do not chain.
+//
+// The linked accounts of an entity are looked up in Wiz rather than accumulated during the sync, so users and grants
+// resolve the same user whatever order, or process, the sync phases run in.
+type identityCorrelator struct {
+	client *client.Client
+}
+
+func newIdentityCorrelator(client *client.Client) *identityCorrelator {
+	return &identityCorrelator{client: client}
+}
+
+// Members returns the accounts linked with the entity, its identity provider user first, always including the entity.
+func (ic *identityCorrelator) Members(ctx context.Context, entity *client.GrantedEntity) ([]*client.GrantedEntity, error) {
+	subject := client.IdentitySubject(entity)
+	if subject == "" {
+		return []*client.GrantedEntity{entity}, nil
+	}
+
+	accounts, err := ic.client.LinkedAccounts(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	if slices.ContainsFunc(accounts, func(a *client.GrantedEntity) bool { return a.Id == entity.Id }) {
+		return accounts, nil
+	}
+	// Wiz did not return the entity itself, keep the identity provider user first.
+	if entity.Properties.ExternalId == "" {
+		return append([]*client.GrantedEntity{entity}, accounts...), nil
+	}
+	return append(slices.Clone(accounts), entity), nil
+}
+
+// linkedAccountProfile describes a correlated sub-account for user profiles and grant metadata.
+func linkedAccountProfile(entity *client.GrantedEntity) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                 entity.Id,
+		"name":               entity.Name,
+		"type":               entity.Type,
+		"cloud_platform":     entity.Properties.CloudPlatform,
+		"native_type":        entity.Properties.NativeType,
+		"provider_unique_id": entity.ProviderUniqueId,
+	}
+}
+
+// viaMetadata describes the accounts a grant was observed through, e.g. "via AWS USER_ACCOUNT alice-sso".
+func viaMetadata(accounts []*client.GrantedEntity) map[string]interface{} {
+	via := make([]interface{}, 0, len(accounts))
+	summary := make([]string, 0, len(accounts))
+	for _, account := range accounts {
+		via = append(via, linkedAccountProfile(account))
+		parts := []string{"via"}
+		if account.Properties.CloudPlatform != "" {
+			parts = append(parts, account.Properties.CloudPlatform)
+		}
+		parts = append(parts, account.Type, account.Name)
+		summary = append(summary, strings.Join(parts, " "))
+	}
+	return map[string]interface{}{
+		"via":     via,
+		"summary": strings.Join(summary, ", "),
+	}
+}
@@ -0,0 +1,126 @@
+package connector
+
+import (
+	"context"
+	"strings"
+
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-wiz/pkg/client"
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// explainSampleSize is the number of resource names listed per tenant when explaining a sync.
+const explainSampleSize = 10
+
+// Explanation describes what a sync with the current configuration would cover, from the resources it would list.
+type Explanation struct {
+	Tenants []*TenantExplanation `json:"tenants"`
+}
+
+// TenantExplanation describes the resources a sync would list from one tenant.
+type TenantExplanation struct {
+	Tenant    string `json:"tenant,omitempty"`
+	Resources int    `json:"resources"`
+	// ByType, ByCloudAccount and ByProject count resources by Wiz entity type, cloud account and the Wiz project of
+	// the scopes that matched them. A resource matched by scopes in several projects counts in each.
+	ByType         map[string]int       `json:"by_type"`
+	ByCloudAccount map[string]int       `json:"by_cloud_account"`
+	ByProject      map[string]int       `json:"by_project"`
+	Samples        []string             `json:"samples"`
+	Queries        []*client.ScopeQuery `json:"queries"`
+	// GrantedEntityTypes are the principal types any scope reads effective access for, and EffectiveAccessCalls
+	// estimates the effective access calls of the sync: one per resource and granted entity type of the scope
+	// listing it, plus one per extra page of client.DefaultPageSize entries.
+	GrantedEntityTypes   []string `json:"granted_entity_types"`
+	EffectiveAccessCalls int      `json:"estimated_effective_access_calls"`
+}
+
+// Explain lists the resources every tenant's selectors match, without reading their effective access.
+func (d *Connector) Explain(ctx context.Context) (*Explanation, error) {
+	rv := &Explanation{Tenants: make([]*TenantExplanation, 0, len(d.tenants))}
+	for _, t := range d.tenants {
+		t.client.ReadResourceProperties()
+		te, err := t.explain(ctx)
+		if err != nil {
+			return nil, err
+		}
+		rv.Tenants = append(rv.Tenants, te)
+	}
+	return rv, nil
+}
+
+func (t *tenant) explain(ctx context.Context) (*TenantExplanation, error) {
+	te := &TenantExplanation{
+		Tenant:             t.name,
+		ByType:             make(map[string]int),
+		ByCloudAccount:     make(map[string]int),
+		ByProject:          make(map[string]int),
+		Samples:            []string{},
+		Queries:            t.client.ScopeQueries(),
+		GrantedEntityTypes: t.client.GrantedEntityTypes(),
+	}
+
+	// Resources are listed once, with every scope that selects them.
+	seen := mapset.NewThreadUnsafeSet[string]()
+	seenInProject := mapset.NewThreadUnsafeSet[string]()
+	pToken := &pagination.Token{}
+	for {
+		resources, nextPageToken, err := t.client.ListResources(ctx, pToken)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, n := range resources.Data.GraphSearch.Nodes {
+			for i := range n.Entities {
+				e := &n.Entities[i]
+				scopes := e.Scopes
+				if len(scopes) == 0 {
+					// The scope built from flags is unnamed and not recorded on resources.
+					scopes = []string{""}
+				}
+				for _, scope := range scopes {
+					projectID := t.client.ScopeProjectID(scope)
+					if seenInProject.Add(e.Id + "\x00" + projectID) {
+						te.ByProject[projectLabel(projectID)]++
+					}
+				}
+
+				if !seen.Add(e.Id) {
+					continue
+				}
+				te.Resources++
+				te.EffectiveAccessCalls += len(t.client.ResourceGrantedEntityTypes(e.Id))
+				te.ByType[e.Type]++
+				te.ByCloudAccount[cloudAccountLabel(&e.Properties)]++
+				if len(te.Samples) < explainSampleSize {
+					te.Samples = append(te.Samples, t.typeMappings.displayName(e))
+				}
+			}
+		}
+
+		if nextPageToken == "" {
+			break
+		}
+		pToken.Token = nextPageToken
+	}
+
+	return te, nil
+}
+
+func cloudAccountLabel(properties *client.ResourceProperties) string {
+	if properties.SubscriptionExternalId == "" {
+		return "unknown"
+	}
+	label := strings.TrimSpace(properties.CloudPlatform + " " + properties.SubscriptionExternalId)
+	if properties.SubscriptionName != "" {
+		label += " (" + properties.SubscriptionName + ")"
+	}
+	return label
+}
+
+func projectLabel(projectID string) string {
+	if projectID == "*" {
+		return "all projects"
+	}
+	return projectID
+}
@@ -0,0 +1,151 @@
+package connector
+
+import (
+	"context"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-wiz/pkg/client"
+)
+
+// ResourceAccess is one effective access entry of a resource, read from the Wiz API for an export.
+type ResourceAccess struct {
+	// ResourceID and PrincipalID are the IDs the sync gives the resource and principal, namespaced by tenant when
+	// several tenants are synced.
+	ResourceID   string
+	ResourceName string
+	Resource     *client.GraphEntity
+	PrincipalID  string
+	Principal    *client.GrantedEntity
+	Permissions  []string
+	// AccessPath reads like the access_path_summary grant metadata, it is empty when Wiz returned no path.
+	AccessPath string
+}
+
+// EffectiveAccess calls fn with the effective access entries of every resource the sync would list, tenant after
+// tenant. Entries are handed to fn as their page is read and nothing is kept, so exports run in constant memory. The
+// connector must be created with Config.Export.
+func (d *Connector) EffectiveAccess(ctx context.Context, fn func(*ResourceAccess) error) error {
+	for _, t := range d.tenants {
+		err := t.effectiveAccess(ctx, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *tenant) effectiveAccess(ctx context.Context, fn func(*ResourceAccess) error) error {
+	resourcesToken := &pagination.Token{}
+	for {
+		resources, nextPageToken, err := t.client.ListResources(ctx, resourcesToken)
+		if err != nil {
+			return err
+		}
+
+		for _, n := range resources.Data.GraphSearch.Nodes {
+			for i := range n.Entities {
+				err = t.resourceAccess(ctx, &n.Entities[i], fn)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if nextPageToken == "" {
+			return nil
+		}
+		resourcesToken.Token = nextPageToken
+	}
+}
+
+func (t *tenant) resourceAccess(ctx context.Context, resource *client.GraphEntity, fn func(*ResourceAccess) error) error {
+	resourceID := t.syncID(resource.Id)
+	resourceName := t.typeMappings.displayName(resource)
+
+	accessToken := &pagination.Token{}
+	for {
+		page, nextPageToken, err := t.client.ListResourceEffectiveAccess(ctx, resource.Id, accessToken)
+		if err != nil {
+			return err
+		}
+
+		for _, n := range page.Data.EntityEffectiveAccessEntries.Nodes {
+			if n.GrantedEntity == nil {
+				continue
+			}
+			principalID := n.GrantedEntity.Id
+			if !t.config.ExternalSyncMode {
+				principalID, err = t.identity.forScope(page.Scope).Resolve(ctx, n.GrantedEntity)
+				if err != nil {
+					return err
+				}
+			}
+			principalID = t.syncID(principalID)
+
+			err = fn(&ResourceAccess{
+				ResourceID:   resourceID,
+				ResourceName: resourceName,
+				Resource:     resource,
+				PrincipalID:  principalID,
+				Principal:    n.GrantedEntity,
+				Permissions:  n.Permissions,
+				AccessPath:   accessPathSummary(n.GrantedEntity, n.AccessPath, resourceName),
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if nextPageToken == "" {
+			return nil
+		}
+		accessToken.Token = nextPageToken
+	}
+}
+
+// resourceEntityKey holds the resourceEntity of a Wiz resource.
+const resourceEntityKey = "wiz_entity"
+
+// resourceEntity is the Wiz entity behind a synced resource.
+type resourceEntity struct {
+	Type             string `json:"type"`
+	CloudPlatform    string `json:"cloud_platform,omitempty"`
+	CloudAccount     string `json:"cloud_account,omitempty"`
+	CloudAccountName string `json:"cloud_account_name,omitempty"`
+}
+
+// ResourceEntity returns the Wiz entity type of a synced resource or principal, and the cloud account resources were
+// annotated with. Values are empty for resources synced by earlier versions.
+//
+// The cloud platform and account come from the resource properties, which a sync only reads when another option
+// needs them: --mark-sensitive-entitlements, --enrich-security-context, an incremental sync, or exclusions on resource
+// tags, native types or cloud providers. Exports of other syncs leave them empty; exports from the Wiz API always
+// have them.
+func ResourceEntity(resource *v2.Resource) (entityType string, cloudPlatform string, cloudAccount string) {
+	switch resource.GetId().GetResourceType() {
+	case userResourceType.Id:
+		trait, err := rs.GetUserTrait(resource)
+		if err == nil && trait.GetAccountType() == v2.UserTrait_ACCOUNT_TYPE_SERVICE {
+			return client.GrantedEntityTypeServiceAccount, "", ""
+		}
+		return client.GrantedEntityTypeUserAccount, "", ""
+	case groupResourceType.Id:
+		return client.GrantedEntityTypeGroup, "", ""
+	case roleResourceType.Id:
+		return client.AccessPathEntityTypeAccessRole, "", ""
+	}
+
+	entity := &resourceEntity{}
+	if !findKeyedAnnotation(resource.GetAnnotations(), resourceEntityKey, entity) {
+		return "", "", ""
+	}
+	return entity.Type, entity.CloudPlatform, entity.CloudAccount
+}
+
+// IsWizResource reports whether the resource is a Wiz resource access is granted on, rather than a principal, role,
+// issue or tenant.
+func IsWizResource(id *v2.ResourceId) bool {
+	return id.GetResourceType() == wizQueryResourceType.Id
+}
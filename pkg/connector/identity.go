@@ -0,0 +1,271 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/conductorone/baton-wiz/pkg/client"
+)
+
+const (
+	IdentityStrategyEmail            = "email"
+	IdentityStrategyProviderUniqueID = "providerUniqueId"
+	IdentityStrategyExternalID       = "externalId"
+	IdentityStrategyWizID            = "id"
+	IdentityStrategyMapping          = "mapping"
+)
+
+// DefaultIdentityStrategies resolves principals the way the connector always has: email first, then the Wiz id.
+var DefaultIdentityStrategies = []string{IdentityStrategyEmail, IdentityStrategyWizID}
+
+var validIdentityStrategies = []string{
+	IdentityStrategyEmail,
+	IdentityStrategyProviderUniqueID,
+	IdentityStrategyExternalID,
+	IdentityStrategyWizID,
+	IdentityStrategyMapping,
+}
+
+// identityResolver derives the baton user ID for a Wiz granted entity. Strategies are tried in order and the first
+// one producing a value wins, so the users and grants builders always agree on the principal ID.
+//
+// The mapping strategy merges the same human across AWS, Azure and GCP: the mapping file assigns a canonical ID to
+// any of an entity's identifiers (Wiz id, provider unique id, external id or email), and every entity carrying one
+// of those identifiers resolves to that canonical ID.
+//
+// When correlation is enabled, strategies are applied across all accounts correlated with the entity, so every
+// cloud account of the same human resolves to one user, see identityCorrelator.
+//
+// Sync profile scopes can set their own strategies and mapping file, which resolve the principals with access to
+// the resources they list.
+type identityResolver struct {
+	strategies []string
+	mapping    map[string]string
+	correlator *identityCorrelator
+	// report records principals without an email when the email strategy is used.
+	report *syncReport
+	// scopes holds the resolver of each sync profile scope, the receiver itself for scopes keeping its settings.
+	scopes map[string]*identityResolver
+}
+
+func newIdentityResolver(strategies []string, mappingFile string) (*identityResolver, error) {
+	if len(strategies) == 0 {
+		strategies = DefaultIdentityStrategies
+	}
+
+	usesMapping := false
+	for _, s := range strategies {
+		if !isValidIdentityStrategy(s) {
+			return nil, fmt.Errorf("wiz-connector: invalid identity strategy %q, must be one of %s", s, strings.Join(validIdentityStrategies, ", "))
+		}
+		if s == IdentityStrategyMapping {
+			usesMapping = true
+		}
+	}
+
+	if usesMapping && mappingFile == "" {
+		return nil, fmt.Errorf("wiz-connector: identity strategy %q requires an identity mapping file", IdentityStrategyMapping)
+	}
+
+	ir := &identityResolver{strategies: strategies, mapping: map[string]string{}}
+	if mappingFile != "" {
+		mapping, err := loadIdentityMapping(mappingFile)
+		if err != nil {
+			return nil, err
+		}
+		ir.mapping = mapping
+	}
+
+	return ir, nil
+}
+
+// setScopes creates the resolvers of the scopes, sharing the receiver's correlator and report. Scopes inherit the
+// receiver's strategies and mappingFile, and scopes resolving principals the same way share a resolver.
+func (ir *identityResolver) setScopes(scopes []*ProfileScope, mappingFile string) error {
+	ir.scopes = make(map[string]*identityResolver, len(scopes))
+	shared := make(map[string]*identityResolver)
+	for _, s := range scopes {
+		if len(s.IdentityStrategies) == 0 && s.IdentityMappingFile == "" {
+			ir.scopes[s.Name] = ir
+			continue
+		}
+		key := strings.Join(s.IdentityStrategies, ",") + "\x00" + s.IdentityMappingFile
+		if resolver, ok := shared[key]; ok {
+			ir.scopes[s.Name] = resolver
+			continue
+		}
+
+		strategies := s.IdentityStrategies
+		if len(strategies) == 0 {
+			strategies = ir.strategies
+		}
+		file := s.IdentityMappingFile
+		if file == "" {
+			file = mappingFile
+		}
+		resolver, err := newIdentityResolver(strategies, file)
+		if err != nil {
+			return fmt.Errorf("wiz-connector: sync profile scope %q: %w", s.Name, err)
+		}
+		resolver.correlator = ir.correlator
+		resolver.report = ir.report
+		shared[key] = resolver
+		ir.scopes[s.Name] = resolver
+	}
+	return nil
+}
+
+// forScope returns the resolver of the principals with access to the resources the scope lists.
+func (ir *identityResolver) forScope(name string) *identityResolver {
+	if resolver, ok := ir.scopes[name]; ok {
+		return resolver
+	}
+	return ir
+}
+
+// unscoped returns the resolver of principals read without a resource, such as those assigned a role: the resolver
+// every scope shares, or the receiver when scopes resolve principals differently.
+func (ir *identityResolver) unscoped() *identityResolver {
+	var rv *identityResolver
+	for _, resolver := range ir.scopes {
+		if rv != nil && resolver != rv {
+			return ir
+		}
+		rv = resolver
+	}
+	if rv == nil {
+		return ir
+	}
+	return rv
+}
+
+// loadIdentityMapping reads a JSON object of Wiz identifier to canonical user ID.
+func loadIdentityMapping(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("wiz-connector: error reading identity mapping file: %w", err)
+	}
+
+	mapping := make(map[string]string)
+	err = json.Unmarshal(data, &mapping)
+	if err != nil {
+		return nil, fmt.Errorf(`wiz-connector: error parsing identity mapping file, format should be {"identifier":"canonical-id"}: %w`, err)
+	}
+
+	for k, v := range mapping {
+		if k == "" || v == "" {
+			return nil, fmt.Errorf("wiz-connector: identity mapping file contains an empty identifier or canonical id")
+		}
+	}
+
+	return mapping, nil
+}
+
+func isValidIdentityStrategy(strategy string) bool {
+	for _, s := range validIdentityStrategies {
+		if s == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the baton user ID for the granted entity.
+func (ir *identityResolver) Resolve(ctx context.Context, entity *client.GrantedEntity) (string, error) {
+	accounts, err := ir.LinkedAccounts(ctx, entity)
+	if err != nil {
+		return "", err
+	}
+	if ir.report != nil && slices.Contains(ir.strategies, IdentityStrategyEmail) && !slices.ContainsFunc(accounts, hasEmail) {
+		ir.report.principalWithoutEmail(entity)
+	}
+	return ir.resolveAccounts(accounts), nil
+}
+
+func hasEmail(entity *client.GrantedEntity) bool {
+	return primaryEmail(entity) != ""
+}
+
+// LinkedAccounts returns the accounts correlated with the entity, or the entity alone when correlation is disabled.
+func (ir *identityResolver) LinkedAccounts(ctx context.Context, entity *client.GrantedEntity) ([]*client.GrantedEntity, error) {
+	if ir.correlator == nil {
+		return []*client.GrantedEntity{entity}, nil
+	}
+	return ir.correlator.Members(ctx, entity)
+}
+
+// resolveAccounts returns the user ID of correlated accounts. A canonical ID the mapping file assigns to any of them
+// wins when correlating, otherwise strategies are tried in order across the accounts.
+func (ir *identityResolver) resolveAccounts(accounts []*client.GrantedEntity) string {
+	if ir.correlator != nil {
+		for _, account := range accounts {
+			if id := ir.resolveWith(IdentityStrategyMapping, account); id != "" {
+				return id
+			}
+		}
+	}
+	for _, s := range ir.strategies {
+		for _, account := range accounts {
+			if id := ir.resolveWith(s, account); id != "" {
+				return id
+			}
+		}
+	}
+	return accounts[0].Id
+}
+
+func (ir *identityResolver) resolveWith(strategy string, entity *client.GrantedEntity) string {
+	switch strategy {
+	case IdentityStrategyEmail:
+		return primaryEmail(entity)
+	case IdentityStrategyProviderUniqueID:
+		if entity.ProviderUniqueId != "" {
+			return entity.ProviderUniqueId
+		}
+		return entity.Properties.ProviderUniqueId
+	case IdentityStrategyExternalID:
+		return entity.Properties.ExternalId
+	case IdentityStrategyWizID:
+		return entity.Id
+	case IdentityStrategyMapping:
+		for _, identifier := range entityIdentifiers(entity) {
+			if id, ok := ir.mapping[identifier]; ok {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// primaryEmail returns the entity's primary email, falling back to its email property.
+func primaryEmail(entity *client.GrantedEntity) string {
+	if entity.Properties.PrimaryEmail != "" {
+		return entity.Properties.PrimaryEmail
+	}
+	return entity.Properties.Email
+}
+
+// entityIdentifiers returns every identifier the mapping file can key on, most specific first.
+func entityIdentifiers(entity *client.GrantedEntity) []string {
+	candidates := []string{
+		entity.Id,
+		entity.ProviderUniqueId,
+		entity.Properties.ProviderUniqueId,
+		entity.Properties.ExternalId,
+		entity.Properties.PrimaryEmail,
+		entity.Properties.Email,
+	}
+	candidates = append(candidates, entity.Properties.Emails...)
+
+	identifiers := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		if c != "" {
+			identifiers = append(identifiers, c)
+		}
+	}
+	return identifiers
+}
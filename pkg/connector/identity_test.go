@@ -0,0 +1,64 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/conductorone/baton-wiz/pkg/client"
+)
+
+func TestIdentityResolverScopes(t *testing.T) {
+	ir, err := newIdentityResolver(nil, "")
+	if err != nil {
+		t.Fatalf("newIdentityResolver() error = %v", err)
+	}
+	byID := []string{IdentityStrategyWizID}
+	err = ir.setScopes([]*ProfileScope{
+		{Name: "prod", IdentityStrategies: byID},
+		{Name: "dev"},
+		{Name: "staging", IdentityStrategies: byID},
+	}, "")
+	if err != nil {
+		t.Fatalf("setScopes() error = %v", err)
+	}
+
+	entity := &client.GrantedEntity{Id: "u1", Type: client.GrantedEntityTypeUserAccount}
+	entity.Properties.Email = "alice@example.com"
+	tests := []struct {
+		scope string
+		want  string
+	}{
+		{scope: "prod", want: "u1"},
+		{scope: "staging", want: "u1"},
+		{scope: "dev", want: "alice@example.com"},
+		{scope: "", want: "alice@example.com"},
+	}
+	for _, tt := range tests {
+		got, err := ir.forScope(tt.scope).Resolve(context.Background(), entity)
+		if err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("scope %q resolved %q, want %q", tt.scope, got, tt.want)
+		}
+	}
+	if ir.forScope("prod") != ir.forScope("staging") {
+		t.Error("scopes resolving principals the same way do not share a resolver")
+	}
+	if ir.unscoped() != ir {
+		t.Error("unscoped() of scopes resolving principals differently is not the tenant's resolver")
+	}
+
+	err = ir.setScopes([]*ProfileScope{{Name: "prod", IdentityStrategies: byID}, {Name: "staging", IdentityStrategies: byID}}, "")
+	if err != nil {
+		t.Fatalf("setScopes() error = %v", err)
+	}
+	if ir.unscoped() != ir.forScope("prod") {
+		t.Error("unscoped() is not the resolver every scope shares")
+	}
+
+	err = ir.setScopes([]*ProfileScope{{Name: "prod", IdentityStrategies: []string{IdentityStrategyMapping}}}, "")
+	if err == nil {
+		t.Error("setScopes() of a mapping strategy without a mapping file succeeded")
+	}
+}
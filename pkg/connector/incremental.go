@@ -0,0 +1,519 @@
+package connector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	reader_v2 "github.com/conductorone/baton-sdk/pb/c1/reader/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/dotc1z"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/conductorone/baton-wiz/pkg/client"
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	// incrementalOverlap widens the change window past the start of the previous sync, since Wiz only updates
+	// entities once its scans are ingested.
+	incrementalOverlap = time.Hour
+
+	// Page tokens of pages read from the previous sync, and of the user pages read from Wiz after them.
+	previousSyncPageToken = "previous-sync:"
+	wizPageToken          = "wiz:"
+)
+
+// incrementalState is what incremental syncs remember of the last completed sync.
+type incrementalState struct {
+	LastSyncStartedAt time.Time `json:"last_sync_started_at"`
+	LastFullSyncAt    time.Time `json:"last_full_sync_at"`
+	// Fingerprint identifies the settings entitlements and grants were built with.
+	Fingerprint string `json:"fingerprint"`
+}
+
+// incrementalSync carries the entitlements and grants of resources left untouched since the last sync over from the
+// previous sync of the c1z file, and only reads effective access from Wiz for the others: resources Wiz updated, new
+// resources and resources that updated principals, roles or policies give access to. Users and roles of the previous
+// sync are emitted again along with those of changed resources.
+//
+// Revocations Wiz records without updating anything the sync reads are up to the full sync interval stale: grants of
+// principals Wiz deleted stay on unchanged resources, and users and roles that lost all access linger.
+//
+// A sync is full when there is no state or previous sync, when the settings changed, when the last full sync is older
+// than the full sync interval or when Wiz cannot tell what changed. The state is only written once a sync completes.
+type incrementalSync struct {
+	statePath        string
+	previousPath     string
+	fullSyncInterval time.Duration
+	fingerprint      string
+	startedAt        time.Time
+	tenants          []*tenant
+	// state is the state of the last sync, nil when this sync is full.
+	state *incrementalState
+
+	once     sync.Once
+	err      error
+	previous *dotc1z.C1File
+}
+
+func newIncrementalSync(ctx context.Context, config *Config, tenants []*tenant) (*incrementalSync, error) {
+	if !config.IncrementalSync {
+		return nil, nil
+	}
+	l := ctxzap.Extract(ctx)
+
+	if config.IncrementalStateFile == "" || config.PreviousSyncFile == "" {
+		// Commands other than a sync have no c1z file.
+		return nil, nil
+	}
+
+	fingerprint, err := incrementalFingerprint(tenants)
+	if err != nil {
+		return nil, err
+	}
+	s := &incrementalSync{
+		statePath:        config.IncrementalStateFile,
+		previousPath:     config.PreviousSyncFile,
+		fullSyncInterval: config.FullSyncInterval,
+		fingerprint:      fingerprint,
+		startedAt:        time.Now(),
+		tenants:          tenants,
+	}
+
+	state, err := readIncrementalState(s.statePath)
+	switch {
+	case err != nil:
+		l.Warn("wiz-connector: error reading incremental sync state, running a full sync", zap.Error(err))
+	case state == nil:
+		l.Info("wiz-connector: no incremental sync state, running a full sync", zap.String("state_file", s.statePath))
+	case state.Fingerprint != fingerprint:
+		l.Info("wiz-connector: sync settings changed since the last sync, running a full sync")
+	case s.fullSyncInterval > 0 && s.startedAt.Sub(state.LastFullSyncAt) >= s.fullSyncInterval:
+		l.Info("wiz-connector: full sync interval elapsed, running a full sync",
+			zap.Time("last_full_sync_at", state.LastFullSyncAt),
+			zap.Duration("full_sync_interval", s.fullSyncInterval))
+	default:
+		_, err = os.Stat(s.previousPath)
+		if err != nil {
+			l.Info("wiz-connector: no previous sync to carry over, running a full sync", zap.String("file", s.previousPath))
+			break
+		}
+		s.state = state
+	}
+	return s, nil
+}
+
+func readIncrementalState(path string) (*incrementalState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("wiz-connector: error reading incremental sync state: %w", err)
+	}
+	state := &incrementalState{}
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, fmt.Errorf("wiz-connector: error parsing incremental sync state %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// incrementalFingerprint hashes the settings of every tenant and sync profile scope that shape entitlements, grants
+// and principal IDs, with the content of the identity mapping and access taxonomy files. Settings that only select
+// resources are left out: resources are listed from Wiz on every sync.
+func incrementalFingerprint(tenants []*tenant) (string, error) {
+	type scopeSettings struct {
+		Name                         string
+		GrantedEntityTypes           []string
+		IdentityStrategies           []string
+		IdentityMapping              string
+		ExcludePrincipalIDs          []string
+		ExcludePrincipalNamePatterns []string
+		ExcludeNativeTypes           []string
+		ExcludeCloudProviders        []string
+	}
+	type tenantSettings struct {
+		Name                         string
+		SyncIdentities               bool
+		SyncServiceAccounts          bool
+		ExternalSyncMode             bool
+		IdentityStrategies           []string
+		IdentityMapping              string
+		CorrelateIdentities          bool
+		IncludeAccessPaths           bool
+		SyncRoles                    bool
+		NormalizeAccessLevels        bool
+		AccessTaxonomy               string
+		MarkSensitiveEntitlements    bool
+		ExcludePrincipalIDs          []string
+		ExcludePrincipalNamePatterns []string
+		ExcludeNativeTypes           []string
+		ExcludeCloudProviders        []string
+		Scopes                       []*scopeSettings
+	}
+	settings := make([]*tenantSettings, 0, len(tenants))
+	for _, t := range tenants {
+		c := t.config
+		identityMapping, err := fileDigest(c.IdentityMappingFile)
+		if err != nil {
+			return "", err
+		}
+		accessTaxonomy, err := fileDigest(c.AccessTaxonomyFile)
+		if err != nil {
+			return "", err
+		}
+		scopes := make([]*scopeSettings, 0, len(t.profileScopes))
+		for _, s := range t.profileScopes {
+			identityMapping, err := fileDigest(s.IdentityMappingFile)
+			if err != nil {
+				return "", err
+			}
+			ss := &scopeSettings{
+				Name:               s.Name,
+				GrantedEntityTypes: s.GrantedEntityTypes,
+				IdentityStrategies: s.IdentityStrategies,
+				IdentityMapping:    identityMapping,
+			}
+			if ex := s.Exclusions; ex != nil {
+				ss.ExcludePrincipalIDs = ex.PrincipalIDs
+				ss.ExcludePrincipalNamePatterns = ex.PrincipalNames
+				ss.ExcludeNativeTypes = ex.NativeTypes
+				ss.ExcludeCloudProviders = ex.CloudProviders
+			}
+			scopes = append(scopes, ss)
+		}
+		settings = append(settings, &tenantSettings{
+			Name:                         t.name,
+			SyncIdentities:               c.SyncIdentities,
+			SyncServiceAccounts:          c.SyncServiceAccounts,
+			ExternalSyncMode:             c.ExternalSyncMode,
+			IdentityStrategies:           c.IdentityStrategies,
+			IdentityMapping:              identityMapping,
+			CorrelateIdentities:          c.CorrelateIdentities,
+			IncludeAccessPaths:           c.IncludeAccessPaths,
+			SyncRoles:                    c.SyncRoles,
+			NormalizeAccessLevels:        c.NormalizeAccessLevels,
+			AccessTaxonomy:               accessTaxonomy,
+			MarkSensitiveEntitlements:    c.MarkSensitiveEntitlements,
+			ExcludePrincipalIDs:          c.ExcludePrincipalIDs,
+			ExcludePrincipalNamePatterns: c.ExcludePrincipalNamePatterns,
+			ExcludeNativeTypes:           c.ExcludeNativeTypes,
+			ExcludeCloudProviders:        c.ExcludeCloudProviders,
+			Scopes:                       scopes,
+		})
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// fileDigest returns the SHA-256 of the file's content, empty when no file is given.
+func fileDigest(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("wiz-connector: error reading %s: %w", path, err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// prepare opens the previous sync and finds the resources updated principals, roles and policies give access to, once
+// per sync and before any resource is listed. The sync falls back to a full one when the c1z file holds no usable
+// previous sync.
+func (s *incrementalSync) prepare(ctx context.Context) error {
+	s.once.Do(func() {
+		if s.state != nil {
+			s.err = s.start(ctx)
+		}
+	})
+	return s.err
+}
+
+func (s *incrementalSync) start(ctx context.Context) error {
+	l := ctxzap.Extract(ctx)
+
+	previous, err := dotc1z.NewC1ZFile(ctx, s.previousPath)
+	if err != nil {
+		return fmt.Errorf("wiz-connector: error opening previous sync %s: %w", s.previousPath, err)
+	}
+	s.previous = previous
+
+	syncID, err := previous.LatestFinishedSync(ctx)
+	if err != nil {
+		return fmt.Errorf("wiz-connector: error reading previous sync %s: %w", s.previousPath, err)
+	}
+	var previousSync *reader_v2.SyncRun
+	if syncID != "" {
+		resp, err := previous.GetSync(ctx, &reader_v2.SyncsReaderServiceGetSyncRequest{SyncId: syncID})
+		if err != nil {
+			return fmt.Errorf("wiz-connector: error reading previous sync %s: %w", s.previousPath, err)
+		}
+		previousSync = resp.GetSync()
+	}
+	// The c1z file holds the last sync unless it was replaced or failed to save after the state was written.
+	if previousSync == nil || previousSync.GetEndedAt().AsTime().Before(s.state.LastSyncStartedAt) {
+		l.Info("wiz-connector: the c1z file does not hold the last sync, running a full sync", zap.String("file", s.previousPath))
+		s.state = nil
+		return s.closePrevious()
+	}
+
+	known, err := s.previousResourceIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	since := s.state.LastSyncStartedAt.Add(-incrementalOverlap)
+	changes := make([]*client.Changes, 0, len(s.tenants))
+	for _, t := range s.tenants {
+		c, err := t.client.ChangedResources(ctx, since)
+		if errors.Is(err, client.ErrChangesUnknown) {
+			l.Warn("wiz-connector: cannot tell what changed since the last sync, running a full sync", zap.String("tenant", t.name), zap.Error(err))
+			s.state = nil
+			return s.closePrevious()
+		}
+		if err != nil {
+			return err
+		}
+		changes = append(changes, c)
+	}
+	for i, t := range s.tenants {
+		c := changes[i]
+		t.client.EnableIncremental(since, c.Resources, func(resourceID string) bool {
+			return known.ContainsOne(t.syncID(resourceID))
+		})
+		l.Info("wiz-connector: incremental sync",
+			zap.String("tenant", t.name),
+			zap.Time("since", since),
+			zap.Int("changed_principals", c.Principals),
+			zap.Int("changed_roles_and_policies", c.AccessPathEntities),
+			zap.Int("changed_resources", c.Resources.Cardinality()),
+			zap.Int("previous_resources", known.Cardinality()),
+		)
+	}
+	return nil
+}
+
+// previousResourceIDs returns the IDs of the Wiz resources of the previous sync.
+func (s *incrementalSync) previousResourceIDs(ctx context.Context) (mapset.Set[string], error) {
+	ids := mapset.NewThreadUnsafeSet[string]()
+	pageToken := ""
+	for {
+		resp, err := s.previous.ListResources(ctx, &v2.ResourcesServiceListResourcesRequest{
+			ResourceTypeId: wizQueryResourceType.Id,
+			PageToken:      pageToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("wiz-connector: error listing resources of previous sync %s: %w", s.previousPath, err)
+		}
+		for _, r := range resp.GetList() {
+			ids.Add(r.GetId().GetResource())
+		}
+		pageToken = resp.GetNextPageToken()
+		if pageToken == "" {
+			return ids, nil
+		}
+	}
+}
+
+// incremental reports whether the sync carries data over from the previous sync.
+func (s *incrementalSync) incremental() bool {
+	return s.state != nil
+}
+
+// unchanged reports whether the entitlements and grants of the Wiz resource are carried over.
+func (s *incrementalSync) unchanged(id *v2.ResourceId) bool {
+	if !s.incremental() {
+		return false
+	}
+	for _, t := range s.tenants {
+		if t.name == "" {
+			return t.client.Unchanged(id.GetResource())
+		}
+		if raw, ok := strings.CutPrefix(id.GetResource(), t.name+tenantSeparator); ok {
+			return t.client.Unchanged(raw)
+		}
+	}
+	return false
+}
+
+// finish records the completed sync for the next one. Failing to write the state is logged and makes the next sync
+// full.
+func (s *incrementalSync) finish(ctx context.Context) {
+	if s == nil {
+		return
+	}
+	l := ctxzap.Extract(ctx)
+
+	err := s.closePrevious()
+	if err != nil {
+		l.Warn("wiz-connector: error closing previous sync", zap.Error(err))
+	}
+
+	state := &incrementalState{
+		LastSyncStartedAt: s.startedAt.UTC(),
+		LastFullSyncAt:    s.startedAt.UTC(),
+		Fingerprint:       s.fingerprint,
+	}
+	if s.incremental() {
+		state.LastFullSyncAt = s.state.LastFullSyncAt
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(s.statePath, data)
+	}
+	if err != nil {
+		l.Error("wiz-connector: error writing incremental sync state", zap.String("state_file", s.statePath), zap.Error(err))
+	}
+}
+
+func (s *incrementalSync) closePrevious() error {
+	if s.previous == nil {
+		return nil
+	}
+	err := s.previous.Close()
+	s.previous = nil
+	return err
+}
+
+// wrap returns the syncers reading unchanged resources from the previous sync.
+func (s *incrementalSync) wrap(ctx context.Context, syncers []connectorbuilder.ResourceSyncer) []connectorbuilder.ResourceSyncer {
+	if s == nil {
+		return syncers
+	}
+	rv := make([]connectorbuilder.ResourceSyncer, 0, len(syncers))
+	for _, syncer := range syncers {
+		rv = append(rv, &incrementalSyncer{ResourceSyncer: syncer, resourceTypeID: syncer.ResourceType(ctx).Id, sync: s})
+	}
+	return rv
+}
+
+// incrementalSyncer serves the entitlements and grants of unchanged Wiz resources from the previous sync, and lists
+// the users and roles of the previous sync before those of changed resources. IDs are those of the sync, namespaced
+// by tenant, so it wraps the syncers of every tenant.
+type incrementalSyncer struct {
+	connectorbuilder.ResourceSyncer
+	resourceTypeID string
+	sync           *incrementalSync
+}
+
+func (o *incrementalSyncer) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	err := o.sync.prepare(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	// Users and roles are found in the effective access of the resources read from Wiz, the previous sync holds
+	// those of unchanged resources.
+	if (o.resourceTypeID != userResourceType.Id && o.resourceTypeID != roleResourceType.Id) || !o.sync.incremental() {
+		return o.ResourceSyncer.List(ctx, parentResourceID, pToken)
+	}
+
+	token := pToken.Token
+	if inner, ok := strings.CutPrefix(token, wizPageToken); ok {
+		rv, nextPageToken, annos, err := o.ResourceSyncer.List(ctx, parentResourceID, &pagination.Token{Token: inner, Size: pToken.Size})
+		if err != nil || nextPageToken == "" {
+			return rv, nextPageToken, annos, err
+		}
+		return rv, wizPageToken + nextPageToken, annos, nil
+	}
+
+	resp, err := o.sync.previous.ListResources(ctx, &v2.ResourcesServiceListResourcesRequest{
+		ResourceTypeId: o.resourceTypeID,
+		PageToken:      strings.TrimPrefix(token, previousSyncPageToken),
+	})
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("wiz-connector: error listing %s resources of previous sync: %w", o.resourceTypeID, err)
+	}
+	var rv []*v2.Resource
+	for _, r := range resp.GetList() {
+		// With several tenants, users and roles are listed once per tenant.
+		if parentResourceID == nil || r.GetParentResourceId().GetResource() == parentResourceID.GetResource() {
+			rv = append(rv, r)
+		}
+	}
+	if resp.GetNextPageToken() == "" {
+		return rv, wizPageToken, nil, nil
+	}
+	return rv, previousSyncPageToken + resp.GetNextPageToken(), nil, nil
+}
+
+// fromPrevious reports whether the page of the resource's entitlements or grants is read from the previous sync, and
+// the page token within it.
+func (o *incrementalSyncer) fromPrevious(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) (bool, string, error) {
+	err := o.sync.prepare(ctx)
+	if err != nil {
+		return false, "", err
+	}
+	if o.resourceTypeID != wizQueryResourceType.Id {
+		return false, "", nil
+	}
+	token := pToken.Token
+	if inner, ok := strings.CutPrefix(token, previousSyncPageToken); ok {
+		return true, inner, nil
+	}
+	return token == "" && o.sync.unchanged(resource.GetId()), "", nil
+}
+
+func (o *incrementalSyncer) Entitlements(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	previous, token, err := o.fromPrevious(ctx, resource, pToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if !previous {
+		return o.ResourceSyncer.Entitlements(ctx, resource, pToken)
+	}
+
+	resp, err := o.sync.previous.ListEntitlements(ctx, &v2.EntitlementsServiceListEntitlementsRequest{Resource: resource, PageToken: token})
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("wiz-connector: error listing entitlements of previous sync: %w", err)
+	}
+	rv := resp.GetList()
+	for _, e := range rv {
+		e.Resource = resource
+	}
+	return rv, previousPageToken(resp.GetNextPageToken()), nil, nil
+}
+
+func (o *incrementalSyncer) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	previous, token, err := o.fromPrevious(ctx, resource, pToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if !previous {
+		return o.ResourceSyncer.Grants(ctx, resource, pToken)
+	}
+
+	resp, err := o.sync.previous.ListGrants(ctx, &v2.GrantsServiceListGrantsRequest{Resource: resource, PageToken: token})
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("wiz-connector: error listing grants of previous sync: %w", err)
+	}
+	rv := resp.GetList()
+	for _, g := range rv {
+		g.Entitlement.Resource = resource
+	}
+	return rv, previousPageToken(resp.GetNextPageToken()), nil, nil
+}
+
+func previousPageToken(token string) string {
+	if token == "" {
+		return ""
+	}
+	return previousSyncPageToken + token
+}
@@ -0,0 +1,44 @@
+package connector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIncrementalFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	taxonomyFile := filepath.Join(dir, "taxonomy.json")
+	write := func(content string) {
+		err := os.WriteFile(taxonomyFile, []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	fingerprint := func(config *Config) string {
+		fp, err := incrementalFingerprint([]*tenant{{config: config}})
+		if err != nil {
+			t.Fatalf("incrementalFingerprint() error = %v", err)
+		}
+		return fp
+	}
+
+	write(`[{"level": "read", "patterns": ["^s3:get"]}]`)
+	base := fingerprint(&Config{NormalizeAccessLevels: true, AccessTaxonomyFile: taxonomyFile})
+	if got := fingerprint(&Config{NormalizeAccessLevels: true, AccessTaxonomyFile: taxonomyFile}); got != base {
+		t.Errorf("fingerprint of the same settings = %s, want %s", got, base)
+	}
+
+	write(`[{"level": "admin", "patterns": ["^s3:get"]}]`)
+	if got := fingerprint(&Config{NormalizeAccessLevels: true, AccessTaxonomyFile: taxonomyFile}); got == base {
+		t.Error("fingerprint did not change with the taxonomy file content")
+	}
+	if got := fingerprint(&Config{NormalizeAccessLevels: true, AccessTaxonomyFile: taxonomyFile, SyncRoles: true}); got == base {
+		t.Error("fingerprint did not change with role sync")
+	}
+
+	_, err := incrementalFingerprint([]*tenant{{config: &Config{IdentityMappingFile: filepath.Join(dir, "missing.yaml")}}})
+	if err == nil {
+		t.Error("incrementalFingerprint() of a missing identity mapping file succeeded")
+	}
+}
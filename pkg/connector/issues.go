@@ -0,0 +1,200 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	sdkEntitlement "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	sdkGrant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-wiz/pkg/client"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	issueAssigneeEntitlement = "assignee"
+	issueKey                 = "wiz_issue"
+)
+
+type issueBuilder struct {
+	client           *client.Client
+	identity         *identityResolver
+	externalSyncMode bool
+}
+
+func (o *issueBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return issueResourceType
+}
+
+// List returns the open issues affecting the parent cloud resource. Issues are only listed under the synced
+// resources, which advertise them as child resources.
+func (o *issueBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentResourceID == nil {
+		return nil, "", nil, nil
+	}
+
+	issues, nextPageToken, err := o.client.ListIssuesForEntity(ctx, parentResourceID.Resource, pToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Resource
+	for _, issue := range issues {
+		resource, err := issueResource(issue, parentResourceID)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		rv = append(rv, resource)
+	}
+
+	return rv, nextPageToken, nil, nil
+}
+
+// issueResource builds the issue resource, recording its details and assignee so grants can be listed later in the
+// sync.
+func issueResource(issue *client.Issue, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	control := ""
+	if issue.SourceRule != nil {
+		control = issue.SourceRule.Name
+	}
+
+	projects := make([]interface{}, 0, len(issue.Projects))
+	for _, p := range issue.Projects {
+		projects = append(projects, p.Name)
+	}
+
+	details := map[string]interface{}{
+		"issue_id":                issue.Id,
+		"severity":                issue.Severity,
+		"status":                  issue.Status,
+		"type":                    issue.Type,
+		"control":                 control,
+		"affected_entity_id":      issue.EntitySnapshot.Id,
+		"affected_entity_name":    issue.EntitySnapshot.Name,
+		"affected_entity_type":    issue.EntitySnapshot.Type,
+		"affected_native_type":    issue.EntitySnapshot.NativeType,
+		"affected_cloud_platform": issue.EntitySnapshot.CloudPlatform,
+		"projects":                projects,
+		"created_at":              issue.CreatedAt,
+		"due_at":                  issue.DueAt,
+	}
+	if issue.Assignee != nil {
+		details["assignee"] = map[string]interface{}{
+			"id":    issue.Assignee.Id,
+			"name":  issue.Assignee.Name,
+			"email": issue.Assignee.Email,
+		}
+	}
+
+	annotation, err := structpb.NewStruct(map[string]interface{}{issueKey: details})
+	if err != nil {
+		return nil, err
+	}
+
+	name := control
+	if name == "" {
+		name = issue.Type
+	}
+	displayName := fmt.Sprintf("%s: %s", name, issue.EntitySnapshot.Name)
+
+	description := fmt.Sprintf("%s %s issue on %s", strings.ToLower(issue.Severity), strings.ToLower(issue.Status), issue.EntitySnapshot.Name)
+	if issue.DueAt != "" {
+		description += fmt.Sprintf(", due %s", issue.DueAt)
+	}
+
+	return rs.NewResource(
+		displayName,
+		issueResourceType,
+		issue.Id,
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithAnnotation(annotation),
+		rs.WithDescription(description),
+	)
+}
+
+// issueAssignee reads back the assignee recorded on the issue resource when it was listed.
+func issueAssignee(resource *v2.Resource) *client.IssueAssignee {
+	for _, a := range resource.GetAnnotations() {
+		st := &structpb.Struct{}
+		if !a.MessageIs(st) || a.UnmarshalTo(st) != nil {
+			continue
+		}
+		details, ok := st.GetFields()[issueKey]
+		if !ok {
+			continue
+		}
+		assignee := details.GetStructValue().GetFields()["assignee"].GetStructValue().GetFields()
+		if assignee == nil {
+			return nil
+		}
+		return &client.IssueAssignee{
+			Id:    assignee["id"].GetStringValue(),
+			Name:  assignee["name"].GetStringValue(),
+			Email: assignee["email"].GetStringValue(),
+		}
+	}
+	return nil
+}
+
+func (o *issueBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	ent := sdkEntitlement.NewAssignmentEntitlement(resource, issueAssigneeEntitlement,
+		sdkEntitlement.WithGrantableTo(userResourceType),
+		sdkEntitlement.WithDisplayName(fmt.Sprintf("%s Assignee", resource.DisplayName)),
+		sdkEntitlement.WithDescription(fmt.Sprintf("Assigned to remediate %s", resource.DisplayName)),
+	)
+	return []*v2.Entitlement{ent}, "", nil, nil
+}
+
+// Grants returns the principals with access to the issue's cloud resource that share the assignee's email. Assignees
+// are Wiz users rather than cloud principals, so they are only granted through the accounts the user builder lists
+// from the resource's effective access, and not at all when they have none.
+func (o *issueBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	assignee := issueAssignee(resource)
+	if assignee == nil || assignee.Email == "" || resource.GetParentResourceId() == nil {
+		return nil, "", nil, nil
+	}
+
+	page, nextPageToken, err := o.client.ListResourceEffectiveAccess(ctx, resource.GetParentResourceId().GetResource(), pToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	identity := o.identity.forScope(page.Scope)
+	var rv []*v2.Grant
+	seen := make(map[string]bool)
+	for _, n := range page.Data.EntityEffectiveAccessEntries.Nodes {
+		if n.GrantedEntity == nil || n.GrantedEntity.Type == client.GrantedEntityTypeGroup || !hasAssigneeEmail(n.GrantedEntity, assignee.Email) {
+			continue
+		}
+		principal, grantOpts, ok, err := grantPrincipal(ctx, identity, o.externalSyncMode, n.GrantedEntity)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if !ok || seen[principal.Resource] {
+			continue
+		}
+		seen[principal.Resource] = true
+		rv = append(rv, sdkGrant.NewGrant(resource, issueAssigneeEntitlement, principal, grantOpts...))
+	}
+
+	return rv, nextPageToken, nil, nil
+}
+
+// hasAssigneeEmail reports whether any of the principal's emails is the assignee's.
+func hasAssigneeEmail(entity *client.GrantedEntity, email string) bool {
+	emails := append([]string{entity.Properties.PrimaryEmail, entity.Properties.Email}, entity.Properties.Emails...)
+	return slices.ContainsFunc(emails, func(e string) bool { return e != "" && strings.EqualFold(e, email) })
+}
+
+func newIssueBuilder(client *client.Client, identity *identityResolver, externalSyncMode bool) *issueBuilder {
+	return &issueBuilder{
+		client:           client,
+		identity:         identity,
+		externalSyncMode: externalSyncMode,
+	}
+}
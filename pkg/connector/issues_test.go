@@ -0,0 +1,35 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/conductorone/baton-wiz/pkg/client"
+)
+
+func TestHasAssigneeEmail(t *testing.T) {
+	entity := func(primary, email string, emails ...string) *client.GrantedEntity {
+		e := &client.GrantedEntity{Id: "u1", Type: client.GrantedEntityTypeUserAccount}
+		e.Properties.PrimaryEmail = primary
+		e.Properties.Email = email
+		e.Properties.Emails = emails
+		return e
+	}
+	tests := []struct {
+		name   string
+		entity *client.GrantedEntity
+		want   bool
+	}{
+		{name: "email", entity: entity("", "alice@example.com"), want: true},
+		{name: "primary email", entity: entity("Alice@Example.com", ""), want: true},
+		{name: "other emails", entity: entity("", "a@example.com", "bob@example.com", "alice@example.com"), want: true},
+		{name: "another user", entity: entity("bob@example.com", "bob@example.com"), want: false},
+		{name: "no email", entity: entity("", ""), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasAssigneeEmail(tt.entity, "alice@example.com"); got != tt.want {
+				t.Errorf("hasAssigneeEmail() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package connector
+
+import (
+	"encoding/json"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// EntitlementMetadataKey holds the EntitlementMetadata of a resource entitlement.
+const EntitlementMetadataKey = "wiz_entitlement"
+
+// Keys of the grant metadata of resource grants.
+const (
+	// GrantMetadataPermissions lists the provider-native permissions behind a normalized access level.
+	GrantMetadataPermissions = "permissions"
+	// GrantMetadataAccessPath lists the steps of the access path, GrantMetadataAccessPathSummary describes it.
+	GrantMetadataAccessPath        = "access_path"
+	GrantMetadataAccessPathSummary = "access_path_summary"
+	// GrantMetadataGroups, GrantMetadataRoles, GrantMetadataRoleBindings and GrantMetadataPolicies list the names of
+	// the access path steps of each kind. GrantMetadataAssumedRoleChain lists the roles when there are several.
+	GrantMetadataGroups           = "groups"
+	GrantMetadataRoles            = "roles"
+	GrantMetadataAssumedRoleChain = "assumed_role_chain"
+	GrantMetadataRoleBindings     = "role_bindings"
+	GrantMetadataPolicies         = "policies"
+)
+
+// EntitlementMetadata is what the connector records on a resource entitlement beyond its name, read back with
+// GetEntitlementMetadata.
+type EntitlementMetadata struct {
+	// Permission is the permission or access level the entitlement is named after. Its slug also carries the
+	// qualifiers of marked entitlements, e.g. "admin (privileged)".
+	Permission string `json:"permission,omitempty"`
+	// AccessLevel and Permissions are set on normalized entitlements: the access level and the provider-native
+	// permissions behind it.
+	AccessLevel string   `json:"access_level,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	// PrivilegeLevel, DataSensitivity and SensitiveDataTypes are set when sensitive entitlements are marked.
+	PrivilegeLevel     string   `json:"privilege_level,omitempty"`
+	DataSensitivity    string   `json:"data_sensitivity,omitempty"`
+	SensitiveDataTypes []string `json:"sensitive_data_types,omitempty"`
+}
+
+// GetEntitlementMetadata returns the metadata recorded on the entitlement, if any.
+func GetEntitlementMetadata(ent *v2.Entitlement) (*EntitlementMetadata, bool) {
+	md := &EntitlementMetadata{}
+	if !findKeyedAnnotation(ent.GetAnnotations(), EntitlementMetadataKey, md) {
+		return nil, false
+	}
+	return md, true
+}
+
+// SecurityContextKey holds the SecurityContext of a resource.
+const SecurityContextKey = "wiz_security_context"
+
+// SecurityContext is what Wiz knows about the risk of a resource, recorded on it with --enrich-security-context and
+// read back with GetSecurityContext.
+type SecurityContext struct {
+	InternetExposed bool `json:"internet_exposed"`
+	// OpenIssues counts the open issues by lower case severity, OpenIssueCount is their total.
+	OpenIssues              map[string]int `json:"open_issues"`
+	OpenIssueCount          int            `json:"open_issue_count"`
+	ToxicCombinations       int            `json:"toxic_combinations"`
+	CriticalVulnerabilities int            `json:"critical_vulnerabilities"`
+	// Summary describes the security context in one line.
+	Summary string `json:"security_summary"`
+}
+
+// GetSecurityContext returns the security context recorded on the resource, if any.
+func GetSecurityContext(resource *v2.Resource) (*SecurityContext, bool) {
+	sc := &SecurityContext{}
+	if !findKeyedAnnotation(resource.GetAnnotations(), SecurityContextKey, sc) {
+		return nil, false
+	}
+	return sc, true
+}
+
+// GrantAccessMetadata is the part of the grant metadata of a resource grant that describes the access, read back
+// with GetGrantAccessMetadata. Its JSON names are the GrantMetadataPermissions and GrantMetadataAccessPathSummary keys.
+type GrantAccessMetadata struct {
+	Permissions       []string `json:"permissions,omitempty"`
+	AccessPathSummary string   `json:"access_path_summary,omitempty"`
+}
+
+// GetGrantAccessMetadata returns the access recorded in the grant metadata, if any.
+func GetGrantAccessMetadata(g *v2.Grant) (*GrantAccessMetadata, bool) {
+	gm := &v2.GrantMetadata{}
+	annos := annotations.Annotations(g.GetAnnotations())
+	ok, err := annos.Pick(gm)
+	if err != nil || !ok {
+		return nil, false
+	}
+	data, err := protojson.Marshal(gm.GetMetadata())
+	if err != nil {
+		return nil, false
+	}
+	md := &GrantAccessMetadata{}
+	if json.Unmarshal(data, md) != nil {
+		return nil, false
+	}
+	return md, true
+}
+
+// keyedAnnotation returns a struct annotation holding the JSON encoding of value under key. Struct annotations are
+// the only kind a connector can add without new message types, so the key tells them apart.
+func keyedAnnotation(key string, value interface{}) (*structpb.Struct, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	return structpb.NewStruct(map[string]interface{}{key: fields})
+}
+
+// findKeyedAnnotation decodes the value of the struct annotation holding key into value, reporting whether one was
+// found.
+func findKeyedAnnotation(annos []*anypb.Any, key string, value interface{}) bool {
+	for _, a := range annos {
+		st := &structpb.Struct{}
+		if !a.MessageIs(st) || a.UnmarshalTo(st) != nil {
+			continue
+		}
+		field, ok := st.GetFields()[key]
+		if !ok {
+			continue
+		}
+		data, err := protojson.Marshal(field)
+		if err != nil {
+			return false
+		}
+		return json.Unmarshal(data, value) == nil
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package connector
+
+import (
+	"slices"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	sdkGrant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-wiz/pkg/client"
+)
+
+func TestGetGrantAccessMetadata(t *testing.T) {
+	resource := &v2.Resource{Id: &v2.ResourceId{ResourceType: wizQueryResourceType.Id, Resource: "r1"}}
+	principal := &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "alice@example.com"}
+
+	g := sdkGrant.NewGrant(resource, "read", principal, sdkGrant.WithGrantMetadata(map[string]interface{}{
+		GrantMetadataPermissions:       stringsToInterfaces([]string{"s3:GetObject", "s3:ListBucket"}),
+		GrantMetadataAccessPathSummary: "alice -> role Reader -> bucket",
+	}))
+	md, ok := GetGrantAccessMetadata(g)
+	if !ok {
+		t.Fatal("GetGrantAccessMetadata() found no metadata")
+	}
+	if want := []string{"s3:GetObject", "s3:ListBucket"}; !slices.Equal(md.Permissions, want) {
+		t.Errorf("Permissions = %v, want %v", md.Permissions, want)
+	}
+	if want := "alice -> role Reader -> bucket"; md.AccessPathSummary != want {
+		t.Errorf("AccessPathSummary = %q, want %q", md.AccessPathSummary, want)
+	}
+
+	_, ok = GetGrantAccessMetadata(sdkGrant.NewGrant(resource, "read", principal))
+	if ok {
+		t.Error("GetGrantAccessMetadata() of a grant without metadata found metadata")
+	}
+}
+
+func TestResourceEntity(t *testing.T) {
+	entity := &client.GraphEntity{Id: "r1", Name: "logs", Type: "BUCKET"}
+	entity.Properties.CloudPlatform = "AWS"
+	entity.Properties.SubscriptionExternalId = "123456789012"
+	annotation, err := entityAnnotation(entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource, err := rs.NewResource("logs bucket", wizQueryResourceType, entity.Id, rs.WithAnnotation(annotation))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entityType, cloudPlatform, cloudAccount := ResourceEntity(resource)
+	if entityType != "BUCKET" || cloudPlatform != "AWS" || cloudAccount != "123456789012" {
+		t.Errorf("ResourceEntity() = %q, %q, %q, want BUCKET, AWS, 123456789012", entityType, cloudPlatform, cloudAccount)
+	}
+
+	user := &v2.Resource{Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "alice@example.com"}}
+	if entityType, _, _ := ResourceEntity(user); entityType != client.GrantedEntityTypeUserAccount {
+		t.Errorf("ResourceEntity() of a user = %q, want %s", entityType, client.GrantedEntityTypeUserAccount)
+	}
+}
+
+func TestGetSecurityContext(t *testing.T) {
+	sc := &securityContext{
+		internetExposed:         true,
+		openIssues:              map[string]int{"CRITICAL": 1, "HIGH": 2},
+		toxicCombinations:       1,
+		criticalVulnerabilities: 3,
+	}
+	annotation, err := keyedAnnotation(SecurityContextKey, sc.metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource, err := rs.NewResource("logs bucket", wizQueryResourceType, "r1", rs.WithAnnotation(annotation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resource.GetAnnotations()) != 1 {
+		t.Errorf("resource annotations = %v, want only the security context", resource.GetAnnotations())
+	}
+
+	got, ok := GetSecurityContext(resource)
+	if !ok {
+		t.Fatal("GetSecurityContext() found no security context")
+	}
+	if !got.InternetExposed || got.OpenIssues["critical"] != 1 || got.OpenIssueCount != 3 || got.CriticalVulnerabilities != 3 {
+		t.Errorf("GetSecurityContext() = %+v", got)
+	}
+	want := "internet exposed; open issues: 1 critical, 2 high; 1 toxic combination; 3 critical vulnerabilities"
+	if got.Summary != want {
+		t.Errorf("GetSecurityContext() summary = %q, want %q", got.Summary, want)
+	}
+
+	if _, ok := GetSecurityContext(&v2.Resource{}); ok {
+		t.Error("GetSecurityContext() of a resource without one found one")
+	}
+}
@@ -0,0 +1,377 @@
+package connector
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/conductorone/baton-wiz/pkg/client"
+	"gopkg.in/yaml.v3"
+)
+
+const syncProfileVersion = 1
+
+var scopeNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// profileGrantedEntityTypes are the granted entity types a scope can sync. User accounts are always synced and
+// groups only in external sync mode.
+var profileGrantedEntityTypes = []string{
+	client.GrantedEntityTypeUserAccount,
+	client.GrantedEntityTypeServiceAccount,
+	client.GrantedEntityTypeIdentity,
+}
+
+// SyncProfile is a declarative sync configuration read from a YAML or JSON file. It declares named scopes, each
+// selecting what to sync and how, instead of a pile of flags and environment variables.
+type SyncProfile struct {
+	Version int             `yaml:"version"`
+	Scopes  []*ProfileScope `yaml:"scopes"`
+	// Tenants are the Wiz tenants synced into one c1z. Without tenants, the tenant configured with flags is synced.
+	Tenants []*ProfileTenant `yaml:"tenants"`
+}
+
+// ProfileTenant holds the credentials and URLs of a Wiz tenant. Fields left empty keep the value from flags.
+type ProfileTenant struct {
+	Name         string `yaml:"name"`
+	ClientID     string `yaml:"clientId"`
+	ClientSecret string `yaml:"clientSecret"`
+	// ClientSecretFile and ClientSecretCommand are read again on every token refresh, like their flags.
+	ClientSecretFile    string `yaml:"clientSecretFile"`
+	ClientSecretCommand string `yaml:"clientSecretCommand"`
+	EndpointURL         string `yaml:"endpointUrl"`
+	AuthURL             string `yaml:"authUrl"`
+	Audience            string `yaml:"audience"`
+	Region              string `yaml:"region"`
+	Environment         string `yaml:"environment"`
+	AuthProvider        string `yaml:"authProvider"`
+}
+
+// config returns a copy of the config using the tenant's credentials and URLs.
+func (t *ProfileTenant) config(base *Config) *Config {
+	c := *base
+	if t.ClientID != "" {
+		c.ClientID = t.ClientID
+	}
+	// A client secret set on the tenant replaces every client secret source from flags.
+	if t.ClientSecret != "" || t.ClientSecretFile != "" || t.ClientSecretCommand != "" {
+		c.ClientSecret = t.ClientSecret
+		c.ClientSecretFile = t.ClientSecretFile
+		c.ClientSecretCommand = t.ClientSecretCommand
+		c.Credentials = nil
+	}
+	if t.EndpointURL != "" {
+		c.EndpointURL = t.EndpointURL
+	}
+	if t.AuthURL != "" {
+		c.AuthURL = t.AuthURL
+	}
+	if t.Audience != "" {
+		c.Audience = t.Audience
+	}
+	// URLs from flags belong to the data center, environment and auth provider from flags, so they are derived again
+	// when the tenant sets its own.
+	if t.Region != "" {
+		c.Region = t.Region
+		if t.EndpointURL == "" {
+			c.EndpointURL = ""
+		}
+	}
+	if t.Environment != "" {
+		c.Environment = t.Environment
+		if t.EndpointURL == "" {
+			c.EndpointURL = ""
+		}
+		if t.AuthURL == "" {
+			c.AuthURL = ""
+		}
+	}
+	if t.AuthProvider != "" {
+		c.AuthProvider = t.AuthProvider
+		if t.AuthURL == "" {
+			c.AuthURL = ""
+		}
+		if t.Audience == "" {
+			c.Audience = ""
+		}
+	}
+	return &c
+}
+
+// ProfileScope selects resources or principals and configures how they are synced. Granted entity types, identity
+// settings, exclusions and the resource type mapping apply to the resources the scope lists, see
+// client.Client.ListResources. Fields left empty keep the value from flags.
+type ProfileScope struct {
+	Name          string        `yaml:"name"`
+	ResourceIDs   []string      `yaml:"resourceIds"`
+	Tags          []*profileTag `yaml:"tags"`
+	ResourceTypes []string      `yaml:"resourceTypes"`
+	ProjectID     string        `yaml:"projectId"`
+	Cloud         *struct {
+		Providers  []string `yaml:"providers"`
+		AccountIDs []string `yaml:"accountIds"`
+		Regions    []string `yaml:"regions"`
+	} `yaml:"cloud"`
+	Principals *struct {
+		Emails            []string `yaml:"emails"`
+		GroupIDs          []string `yaml:"groupIds"`
+		IdentityProviders []string `yaml:"identityProviders"`
+	} `yaml:"principals"`
+	GrantedEntityTypes  []string `yaml:"grantedEntityTypes"`
+	IdentityStrategies  []string `yaml:"identityStrategies"`
+	IdentityMappingFile string   `yaml:"identityMappingFile"`
+	Exclusions          *struct {
+		ResourceIDs    []string      `yaml:"resourceIds"`
+		ResourceNames  []string      `yaml:"resourceNames"`
+		ResourceTags   []*profileTag `yaml:"resourceTags"`
+		PrincipalIDs   []string      `yaml:"principalIds"`
+		PrincipalNames []string      `yaml:"principalNames"`
+		NativeTypes    []string      `yaml:"nativeTypes"`
+		CloudProviders []string      `yaml:"cloudProviders"`
+	} `yaml:"exclusions"`
+	// ResourceTypeMapping maps Wiz entity types to the label used in resource display names, e.g. BUCKET: s3 bucket.
+	ResourceTypeMapping map[string]string `yaml:"resourceTypeMapping"`
+	// Tenants names the tenants the scope is synced from, every tenant when empty. Scopes selecting principals by
+	// email or group usually only make sense in the tenant holding those principals.
+	Tenants []string `yaml:"tenants"`
+}
+
+type profileTag struct {
+	Key   string `yaml:"key"`
+	Value string `yaml:"val"`
+}
+
+// LoadSyncProfile reads and validates the sync profile. JSON is read as YAML, and unknown fields are rejected so
+// typos are not silently ignored.
+func LoadSyncProfile(path string) (*SyncProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("wiz-connector: error reading sync profile: %w", err)
+	}
+
+	profile := &SyncProfile{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(profile)
+	if err != nil {
+		return nil, fmt.Errorf("wiz-connector: error parsing sync profile %s: %w", path, err)
+	}
+
+	err = profile.validate()
+	if err != nil {
+		return nil, fmt.Errorf("wiz-connector: invalid sync profile %s:\n%w", path, err)
+	}
+	return profile, nil
+}
+
+// validate reports every schema violation in the profile, each prefixed with the path of the offending field.
+func (p *SyncProfile) validate() error {
+	var errs []error
+	addErr := func(path string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+
+	if p.Version != syncProfileVersion {
+		addErr("version", "must be %d, got %d", syncProfileVersion, p.Version)
+	}
+	if len(p.Scopes) == 0 {
+		addErr("scopes", "at least one scope is required")
+	}
+
+	names := make(map[string]int)
+	for i, s := range p.Scopes {
+		path := fmt.Sprintf("scopes[%d]", i)
+		if s == nil {
+			addErr(path, "scope is empty")
+			continue
+		}
+
+		switch {
+		case s.Name == "":
+			addErr(path+".name", "is required")
+		case !scopeNamePattern.MatchString(s.Name):
+			addErr(path+".name", "%q must be lowercase letters, digits, '-' or '_'", s.Name)
+		default:
+			if prev, ok := names[s.Name]; ok {
+				addErr(path+".name", "%q is already used by scopes[%d]", s.Name, prev)
+			}
+			names[s.Name] = i
+		}
+
+		hasResources := len(s.ResourceIDs) != 0 || len(s.Tags) != 0 || s.Cloud != nil || s.ProjectID != ""
+		hasPrincipals := s.Principals != nil
+		if !hasResources && !hasPrincipals {
+			addErr(path, "must select resources with resourceIds, tags, cloud or projectId, or principals with principals")
+		}
+		if hasPrincipals && (len(s.ResourceIDs) != 0 || len(s.Tags) != 0 || s.Cloud != nil) {
+			addErr(path+".principals", "cannot be combined with resourceIds, tags or cloud, a scope starts from either principals or resources")
+		}
+		if len(s.ResourceIDs) != 0 && len(s.Tags) != 0 {
+			addErr(path+".tags", "cannot be combined with resourceIds")
+		}
+		if len(s.ResourceIDs) != 0 && s.Cloud != nil {
+			addErr(path+".cloud", "cannot be combined with resourceIds")
+		}
+
+		for j, t := range s.Tags {
+			if t == nil || t.Key == "" || t.Value == "" {
+				addErr(fmt.Sprintf("%s.tags[%d]", path, j), "key and val are required")
+			}
+		}
+		for j, gt := range s.GrantedEntityTypes {
+			if !slices.Contains(profileGrantedEntityTypes, gt) {
+				addErr(fmt.Sprintf("%s.grantedEntityTypes[%d]", path, j), "%q must be one of %s", gt, strings.Join(profileGrantedEntityTypes, ", "))
+			}
+		}
+		for j, strategy := range s.IdentityStrategies {
+			if !isValidIdentityStrategy(strategy) {
+				addErr(fmt.Sprintf("%s.identityStrategies[%d]", path, j), "%q must be one of %s", strategy, strings.Join(validIdentityStrategies, ", "))
+			}
+		}
+		if s.Exclusions != nil {
+			for j, pattern := range s.Exclusions.ResourceNames {
+				if _, err := regexp.Compile(pattern); err != nil {
+					addErr(fmt.Sprintf("%s.exclusions.resourceNames[%d]", path, j), "invalid pattern %q: %v", pattern, err)
+				}
+			}
+			for j, pattern := range s.Exclusions.PrincipalNames {
+				if _, err := regexp.Compile(pattern); err != nil {
+					addErr(fmt.Sprintf("%s.exclusions.principalNames[%d]", path, j), "invalid pattern %q: %v", pattern, err)
+				}
+			}
+			for j, t := range s.Exclusions.ResourceTags {
+				if t == nil || t.Key == "" || t.Value == "" {
+					addErr(fmt.Sprintf("%s.exclusions.resourceTags[%d]", path, j), "key and val are required")
+				}
+			}
+		}
+		for wizType, label := range s.ResourceTypeMapping {
+			if wizType == "" || label == "" {
+				addErr(path+".resourceTypeMapping", "entity types and labels cannot be empty")
+			}
+		}
+	}
+
+	tenantNames := make(map[string]int)
+	for i, t := range p.Tenants {
+		path := fmt.Sprintf("tenants[%d]", i)
+		switch {
+		case t == nil:
+			addErr(path, "tenant is empty")
+		case t.Name == "":
+			addErr(path+".name", "is required")
+		case !scopeNamePattern.MatchString(t.Name):
+			addErr(path+".name", "%q must be lowercase letters, digits, '-' or '_'", t.Name)
+		default:
+			if prev, ok := tenantNames[t.Name]; ok {
+				addErr(path+".name", "%q is already used by tenants[%d]", t.Name, prev)
+			}
+			tenantNames[t.Name] = i
+		}
+		if t != nil && countSet(t.ClientSecret, t.ClientSecretFile, t.ClientSecretCommand) > 1 {
+			addErr(path, "only one of clientSecret, clientSecretFile and clientSecretCommand can be set")
+		}
+	}
+	for i, s := range p.Scopes {
+		if s == nil {
+			continue
+		}
+		for j, name := range s.Tenants {
+			if _, ok := tenantNames[name]; !ok {
+				addErr(fmt.Sprintf("scopes[%d].tenants[%d]", i, j), "%q is not one of the profile's tenants", name)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Select returns the named scope, or every scope when no name is given so that the sync covers their union.
+func (p *SyncProfile) Select(name string) ([]*ProfileScope, error) {
+	if name == "" {
+		return p.Scopes, nil
+	}
+	for _, s := range p.Scopes {
+		if s.Name == name {
+			return []*ProfileScope{s}, nil
+		}
+	}
+	return nil, fmt.Errorf("wiz-connector: sync profile has no scope named %q", name)
+}
+
+// tenantProfileScopes returns the scopes synced from the tenant, none when every scope is bound to other tenants.
+func tenantProfileScopes(scopes []*ProfileScope, tenant string) []*ProfileScope {
+	var rv []*ProfileScope
+	for _, s := range scopes {
+		if len(s.Tenants) == 0 || slices.Contains(s.Tenants, tenant) {
+			rv = append(rv, s)
+		}
+	}
+	return rv
+}
+
+// selectsResources reports whether the scope selects resources or principals itself.
+func (s *ProfileScope) selectsResources() bool {
+	return len(s.ResourceIDs) != 0 || len(s.Tags) != 0 || s.Cloud != nil || s.Principals != nil
+}
+
+// clientScope builds what the scope selects and how its resources' effective access is read. A scope selecting
+// resources or principals replaces the selection made with flags, otherwise it narrows the flag selection with its
+// own resource types and project. Granted entity types and exclusions replace those set with flags.
+func (s *ProfileScope) clientScope(flagScope *client.Scope) *client.Scope {
+	cs := *flagScope
+	cs.Name = s.Name
+	cs.GrantedEntityTypes = s.GrantedEntityTypes
+	if ex := s.Exclusions; ex != nil {
+		cs.Exclusions = &client.ExclusionRules{
+			ResourceIDs:           ex.ResourceIDs,
+			ResourceNamePatterns:  ex.ResourceNames,
+			PrincipalIDs:          ex.PrincipalIDs,
+			PrincipalNamePatterns: ex.PrincipalNames,
+			NativeTypes:           ex.NativeTypes,
+			Providers:             ex.CloudProviders,
+		}
+		for _, t := range ex.ResourceTags {
+			cs.Exclusions.ResourceTags = append(cs.Exclusions.ResourceTags, &client.ResourceTag{Key: t.Key, Value: t.Value})
+		}
+	}
+	if s.selectsResources() {
+		cs.ResourceIDs = s.ResourceIDs
+		cs.ResourceTags = nil
+		for _, t := range s.Tags {
+			cs.ResourceTags = append(cs.ResourceTags, &client.ResourceTag{Key: t.Key, Value: t.Value})
+		}
+		cs.Cloud = nil
+		if s.Cloud != nil {
+			cs.Cloud = &client.CloudScope{Providers: s.Cloud.Providers, AccountIDs: s.Cloud.AccountIDs, Regions: s.Cloud.Regions}
+		}
+		cs.Principals = nil
+		if s.Principals != nil {
+			cs.Principals = &client.PrincipalFilter{
+				Emails:            s.Principals.Emails,
+				GroupIDs:          s.Principals.GroupIDs,
+				IdentityProviders: s.Principals.IdentityProviders,
+			}
+		}
+	}
+	if len(s.ResourceTypes) != 0 {
+		cs.ResourceTypes = s.ResourceTypes
+	}
+	if s.ProjectID != "" {
+		cs.ProjectID = s.ProjectID
+	}
+	return &cs
+}
+
+func countSet(values ...string) int {
+	n := 0
+	for _, v := range values {
+		if v != "" {
+			n++
+		}
+	}
+	return n
+}
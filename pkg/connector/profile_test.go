@@ -0,0 +1,245 @@
+package connector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSyncProfileValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		// wantErrs are the substrings expected in the error, none means the profile is valid.
+		wantErrs []string
+	}{
+		{
+			name: "valid",
+			profile: `
+version: 1
+scopes:
+  - name: prod-buckets
+    tags: [{key: env, val: prod}]
+    resourceTypes: [BUCKET]
+    grantedEntityTypes: [USER_ACCOUNT, SERVICE_ACCOUNT]
+    identityStrategies: [email, id]
+    exclusions:
+      resourceNames: ['^tmp-']
+  - name: admins
+    principals:
+      emails: [admin@example.com]
+tenants:
+  - name: us
+    clientSecretFile: /run/secrets/us
+`,
+		},
+		{
+			name:     "wrong version",
+			profile:  "version: 2\nscopes: [{name: a, projectId: p}]",
+			wantErrs: []string{"version: must be 1, got 2"},
+		},
+		{
+			name:     "no scopes",
+			profile:  "version: 1",
+			wantErrs: []string{"scopes: at least one scope is required"},
+		},
+		{
+			name:     "missing name",
+			profile:  "version: 1\nscopes: [{projectId: p}]",
+			wantErrs: []string{"scopes[0].name: is required"},
+		},
+		{
+			name:     "invalid name",
+			profile:  "version: 1\nscopes: [{name: Prod Buckets, projectId: p}]",
+			wantErrs: []string{`scopes[0].name: "Prod Buckets" must be lowercase letters`},
+		},
+		{
+			name:     "duplicate name",
+			profile:  "version: 1\nscopes: [{name: a, projectId: p}, {name: a, projectId: q}]",
+			wantErrs: []string{`scopes[1].name: "a" is already used by scopes[0]`},
+		},
+		{
+			name:     "selects nothing",
+			profile:  "version: 1\nscopes: [{name: a, resourceTypes: [BUCKET]}]",
+			wantErrs: []string{"scopes[0]: must select resources"},
+		},
+		{
+			name:     "principals with resources",
+			profile:  "version: 1\nscopes: [{name: a, resourceIds: [r1], principals: {emails: [a@example.com]}}]",
+			wantErrs: []string{"scopes[0].principals: cannot be combined"},
+		},
+		{
+			name:    "resource ids with tags and cloud",
+			profile: "version: 1\nscopes: [{name: a, resourceIds: [r1], tags: [{key: k, val: v}], cloud: {providers: [AWS]}}]",
+			wantErrs: []string{
+				"scopes[0].tags: cannot be combined with resourceIds",
+				"scopes[0].cloud: cannot be combined with resourceIds",
+			},
+		},
+		{
+			name:     "incomplete tag",
+			profile:  "version: 1\nscopes: [{name: a, tags: [{key: k}]}]",
+			wantErrs: []string{"scopes[0].tags[0]: key and val are required"},
+		},
+		{
+			name:     "invalid granted entity type",
+			profile:  "version: 1\nscopes: [{name: a, projectId: p, grantedEntityTypes: [GROUP]}]",
+			wantErrs: []string{`scopes[0].grantedEntityTypes[0]: "GROUP" must be one of`},
+		},
+		{
+			name:     "invalid identity strategy",
+			profile:  "version: 1\nscopes: [{name: a, projectId: p, identityStrategies: [upn]}]",
+			wantErrs: []string{`scopes[0].identityStrategies[0]: "upn" must be one of`},
+		},
+		{
+			name:    "invalid exclusions",
+			profile: "version: 1\nscopes: [{name: a, projectId: p, exclusions: {resourceNames: ['('], principalNames: ['['], resourceTags: [{val: v}]}}]",
+			wantErrs: []string{
+				"scopes[0].exclusions.resourceNames[0]: invalid pattern",
+				"scopes[0].exclusions.principalNames[0]: invalid pattern",
+				"scopes[0].exclusions.resourceTags[0]: key and val are required",
+			},
+		},
+		{
+			name:     "empty resource type label",
+			profile:  "version: 1\nscopes: [{name: a, projectId: p, resourceTypeMapping: {BUCKET: ''}}]",
+			wantErrs: []string{"scopes[0].resourceTypeMapping: entity types and labels cannot be empty"},
+		},
+		{
+			name:     "unknown scope tenant",
+			profile:  "version: 1\nscopes: [{name: a, projectId: p, tenants: [us, eu]}]\ntenants: [{name: us}]",
+			wantErrs: []string{`scopes[0].tenants[1]: "eu" is not one of the profile's tenants`},
+		},
+		{
+			name:    "invalid tenants",
+			profile: "version: 1\nscopes: [{name: a, projectId: p}]\ntenants: [{name: us}, {name: us}, {clientId: c}, {name: eu, clientSecret: s, clientSecretFile: f}]",
+			wantErrs: []string{
+				`tenants[1].name: "us" is already used by tenants[0]`,
+				"tenants[2].name: is required",
+				"tenants[3]: only one of clientSecret, clientSecretFile and clientSecretCommand can be set",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := &SyncProfile{}
+			err := yaml.Unmarshal([]byte(tt.profile), profile)
+			if err != nil {
+				t.Fatalf("yaml.Unmarshal() error = %v", err)
+			}
+
+			err = profile.validate()
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("validate() succeeded, want errors %q", tt.wantErrs)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("validate() error = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadSyncProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "yaml", content: "version: 1\nscopes:\n  - name: a\n    projectId: p\n"},
+		{name: "json", content: `{"version": 1, "scopes": [{"name": "a", "resourceIds": ["r1"]}]}`},
+		{name: "unknown field", content: "version: 1\nscopes:\n  - name: a\n    projectIds: [p]\n", wantErr: "field projectIds not found"},
+		{name: "invalid", content: "version: 1\n", wantErr: "invalid sync profile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "profile.yaml")
+			err := os.WriteFile(path, []byte(tt.content), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			profile, err := LoadSyncProfile(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadSyncProfile() error = %v", err)
+				}
+				if len(profile.Scopes) != 1 || profile.Scopes[0].Name != "a" {
+					t.Errorf("LoadSyncProfile() scopes = %+v", profile.Scopes)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadSyncProfile() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	_, err := LoadSyncProfile(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err == nil {
+		t.Error("LoadSyncProfile() of a missing file succeeded")
+	}
+}
+
+func TestProfileTenantConfig(t *testing.T) {
+	base := &Config{
+		ClientID:     "base",
+		EndpointURL:  "https://api.us17.app.wiz.io/graphql",
+		AuthURL:      "https://auth.app.wiz.io/oauth/token",
+		Audience:     "wiz-api",
+		Environment:  "commercial",
+		AuthProvider: "cognito",
+	}
+	tests := []struct {
+		name   string
+		tenant *ProfileTenant
+		want   [3]string
+	}{
+		{
+			name:   "inherits",
+			tenant: &ProfileTenant{ClientID: "c"},
+			want:   [3]string{base.EndpointURL, base.AuthURL, base.Audience},
+		},
+		{
+			name:   "region",
+			tenant: &ProfileTenant{Region: "eu1"},
+			want:   [3]string{"", base.AuthURL, base.Audience},
+		},
+		{
+			name:   "environment",
+			tenant: &ProfileTenant{Environment: "gov"},
+			want:   [3]string{"", "", base.Audience},
+		},
+		{
+			name:   "auth provider",
+			tenant: &ProfileTenant{AuthProvider: "auth0"},
+			want:   [3]string{base.EndpointURL, "", ""},
+		},
+		{
+			name:   "environment with urls",
+			tenant: &ProfileTenant{Environment: "gov", EndpointURL: "https://api.us1.app.wiz.us/graphql", AuthURL: "https://auth.gov.wiz.io/oauth/token"},
+			want:   [3]string{"https://api.us1.app.wiz.us/graphql", "https://auth.gov.wiz.io/oauth/token", base.Audience},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.tenant.config(base)
+			if got := [3]string{c.EndpointURL, c.AuthURL, c.Audience}; got != tt.want {
+				t.Errorf("config() endpoint url, auth url and audience = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if base.EndpointURL == "" || base.AuthURL == "" {
+		t.Error("config() modified the base config")
+	}
+}
@@ -0,0 +1,300 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-wiz/pkg/client"
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	reportStatusFailed    = "failed"
+	reportStatusCompleted = "completed"
+
+	skipReasonMissingExternalID = "missing external id"
+	skipReasonExcludedResource  = "excluded resource"
+	skipReasonExcludedPrincipal = "excluded principal"
+
+	// maxReportItems bounds the skipped items and errors listed individually, the counts stay exact.
+	maxReportItems = 1000
+)
+
+// syncReport collects what a sync did, for the JSON summary written at the end of the run. A nil report records
+// nothing, so builders do not need to check whether a report was requested.
+type syncReport struct {
+	path    string
+	start   time.Time
+	tenants []*tenant
+
+	mtx                   sync.Mutex
+	resourceTypes         map[string]*resourceTypeCounts
+	principalTypes        map[string]mapset.Set[string]
+	skipCounts            map[string]int
+	skipped               []*skippedItem
+	skippedSeen           mapset.Set[string]
+	principalsWithoutMail mapset.Set[string]
+	errors                []*reportError
+}
+
+type resourceTypeCounts struct {
+	Resources    int `json:"resources"`
+	Entitlements int `json:"entitlements"`
+	Grants       int `json:"grants"`
+	Errors       int `json:"errors"`
+}
+
+type skippedItem struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Reason string `json:"reason"`
+}
+
+type reportError struct {
+	ResourceType string `json:"resource_type"`
+	ResourceID   string `json:"resource_id,omitempty"`
+	Call         string `json:"call"`
+	Error        string `json:"error"`
+}
+
+type reportAPICalls struct {
+	Total      int            `json:"total"`
+	Throttled  int            `json:"throttled"`
+	Operations map[string]int `json:"operations"`
+}
+
+type reportSkipped struct {
+	Counts                 map[string]int `json:"counts"`
+	PrincipalsWithoutEmail int            `json:"principals_without_email"`
+	Items                  []*skippedItem `json:"items"`
+}
+
+type reportOutput struct {
+	Status          string                         `json:"status"`
+	StartedAt       time.Time                      `json:"started_at"`
+	FinishedAt      time.Time                      `json:"finished_at"`
+	DurationSeconds float64                        `json:"duration_seconds"`
+	ResourceTypes   map[string]*resourceTypeCounts `json:"resource_types"`
+	PrincipalTypes  map[string]int                 `json:"principal_types"`
+	Skipped         reportSkipped                  `json:"skipped"`
+	Errors          []*reportError                 `json:"errors"`
+	APICalls        reportAPICalls                 `json:"api_calls"`
+}
+
+func newSyncReport(path string) *syncReport {
+	if path == "" {
+		return nil
+	}
+	r := &syncReport{path: path}
+	r.reset()
+	return r
+}
+
+// reset starts the report of a new sync. A process serving several syncs reports each of them on its own.
+func (r *syncReport) reset() {
+	if r == nil {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.start = time.Now()
+	r.resourceTypes = make(map[string]*resourceTypeCounts)
+	r.principalTypes = make(map[string]mapset.Set[string])
+	r.skipCounts = make(map[string]int)
+	r.skippedSeen = mapset.NewThreadUnsafeSet[string]()
+	r.principalsWithoutMail = mapset.NewThreadUnsafeSet[string]()
+	r.skipped = []*skippedItem{}
+	r.errors = []*reportError{}
+	for _, t := range r.tenants {
+		t.client.ResetCounts()
+	}
+}
+
+func (r *syncReport) counts(resourceType string) *resourceTypeCounts {
+	c, ok := r.resourceTypes[resourceType]
+	if !ok {
+		c = &resourceTypeCounts{}
+		r.resourceTypes[resourceType] = c
+	}
+	return c
+}
+
+// recordPage counts what a List, Entitlements or Grants page emitted.
+func (r *syncReport) recordPage(resourceType string, call string, count int) {
+	if r == nil {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	c := r.counts(resourceType)
+	switch call {
+	case "List":
+		c.Resources += count
+	case "Entitlements":
+		c.Entitlements += count
+	case "Grants":
+		c.Grants += count
+	}
+}
+
+// recordError records a page that failed the sync. The report is written right away, since the sync stops on the
+// error. Errors the syncer recovers from are left out: it retries pages that are unavailable or timed out, and skips
+// the entitlements and grants of resources that are not found.
+func (r *syncReport) recordError(ctx context.Context, resourceType string, call string, resourceID string, err error) {
+	if r == nil || !terminalError(call, err) {
+		return
+	}
+	r.mtx.Lock()
+	r.counts(resourceType).Errors++
+	if len(r.errors) < maxReportItems {
+		r.errors = append(r.errors, &reportError{ResourceType: resourceType, ResourceID: resourceID, Call: call, Error: err.Error()})
+	}
+	r.mtx.Unlock()
+
+	r.write(ctx, reportStatusFailed)
+}
+
+// terminalError reports whether the syncer stops on the error of the call, mirroring its retry and skip rules.
+func terminalError(call string, err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return false
+	case codes.NotFound:
+		return call == "List"
+	}
+	return true
+}
+
+// recordPrincipal counts a distinct principal granted access, by Wiz entity type.
+func (r *syncReport) recordPrincipal(entity *client.GrantedEntity) {
+	if r == nil {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	seen, ok := r.principalTypes[entity.Type]
+	if !ok {
+		seen = mapset.NewThreadUnsafeSet[string]()
+		r.principalTypes[entity.Type] = seen
+	}
+	seen.Add(entity.Id)
+}
+
+// skipPrincipal records a principal left out of the sync.
+func (r *syncReport) skipPrincipal(entity *client.GrantedEntity, reason string) {
+	if r == nil {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	key := reason + "\x00" + entity.Id
+	if !r.skippedSeen.Add(key) {
+		return
+	}
+	r.skipCounts[reason]++
+	if len(r.skipped) < maxReportItems {
+		r.skipped = append(r.skipped, &skippedItem{ID: entity.Id, Name: entity.Name, Type: entity.Type, Reason: reason})
+	}
+}
+
+// principalWithoutEmail records a principal identified by another strategy because it has no email.
+func (r *syncReport) principalWithoutEmail(entity *client.GrantedEntity) {
+	if r == nil {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.principalsWithoutMail.Add(entity.Id)
+}
+
+// write replaces the report file with the current state of the sync. Failing to write the report is logged and
+// does not fail the sync.
+func (r *syncReport) write(ctx context.Context, status string) {
+	if r == nil {
+		return
+	}
+	l := ctxzap.Extract(ctx)
+
+	r.mtx.Lock()
+	now := time.Now()
+	out := &reportOutput{
+		Status:          status,
+		StartedAt:       r.start.UTC(),
+		FinishedAt:      now.UTC(),
+		DurationSeconds: now.Sub(r.start).Seconds(),
+		ResourceTypes:   r.resourceTypes,
+		PrincipalTypes:  make(map[string]int, len(r.principalTypes)),
+		Skipped: reportSkipped{
+			Counts:                 make(map[string]int, len(r.skipCounts)+2),
+			PrincipalsWithoutEmail: r.principalsWithoutMail.Cardinality(),
+			Items:                  r.skipped,
+		},
+		Errors:   r.errors,
+		APICalls: reportAPICalls{Operations: make(map[string]int)},
+	}
+	for t, seen := range r.principalTypes {
+		out.PrincipalTypes[t] = seen.Cardinality()
+	}
+	for reason, n := range r.skipCounts {
+		out.Skipped.Counts[reason] = n
+	}
+	for _, t := range r.tenants {
+		resources, principals := t.client.ExclusionCounts()
+		out.Skipped.Counts[skipReasonExcludedResource] += resources
+		out.Skipped.Counts[skipReasonExcludedPrincipal] += principals
+
+		operations, throttled := t.client.APICallCounts()
+		for op, n := range operations {
+			out.APICalls.Operations[op] += n
+			out.APICalls.Total += n
+		}
+		out.APICalls.Throttled += throttled
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	r.mtx.Unlock()
+	if err != nil {
+		l.Error("wiz-connector: error encoding sync report", zap.Error(err))
+		return
+	}
+
+	err = writeFileAtomic(r.path, data)
+	if err != nil {
+		l.Error("wiz-connector: error writing sync report", zap.String("path", r.path), zap.Error(err))
+	}
+}
+
+// writeFileAtomic writes the file through a temporary file, so readers never see a partial report.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("wiz-connector: error creating file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("wiz-connector: error writing file: %w", err)
+	}
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("wiz-connector: error writing file: %w", err)
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,55 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTerminalError(t *testing.T) {
+	tests := []struct {
+		name string
+		call string
+		err  error
+		want bool
+	}{
+		{name: "unknown", call: "List", err: errors.New("boom"), want: true},
+		{name: "unavailable", call: "Grants", err: status.Error(codes.Unavailable, "try again")},
+		{name: "wrapped deadline exceeded", call: "List", err: fmt.Errorf("wiz-connector: %w", status.Error(codes.DeadlineExceeded, "timeout"))},
+		{name: "grants not found", call: "Grants", err: status.Error(codes.NotFound, "gone")},
+		{name: "list not found", call: "List", err: status.Error(codes.NotFound, "gone"), want: true},
+		{name: "permission denied", call: "Entitlements", err: status.Error(codes.PermissionDenied, "denied"), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := terminalError(tt.call, tt.err); got != tt.want {
+				t.Errorf("terminalError(%q, %v) = %v, want %v", tt.call, tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncReportReset(t *testing.T) {
+	ctx := context.Background()
+	r := newSyncReport(filepath.Join(t.TempDir(), "report.json"))
+	r.recordPage("wiz_resource", "List", 3)
+	r.recordError(ctx, "wiz_resource", "Grants", "r1", errors.New("boom"))
+	r.recordError(ctx, "wiz_resource", "Grants", "r2", status.Error(codes.Unavailable, "try again"))
+	if len(r.errors) != 1 {
+		t.Fatalf("recorded %d errors, want only the terminal one", len(r.errors))
+	}
+
+	start := r.start
+	r.reset()
+	if len(r.resourceTypes) != 0 || len(r.errors) != 0 {
+		t.Errorf("reset() kept counts %v and errors %v", r.resourceTypes, r.errors)
+	}
+	if r.start.Before(start) {
+		t.Errorf("reset() start = %v, want it after %v", r.start, start)
+	}
+}
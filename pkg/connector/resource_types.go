@@ -23,3 +23,24 @@ var wizQueryResourceType = &v2.ResourceType{
 	Id:          "wiz_query_resource_type",
 	DisplayName: "WizQueryResourceType",
 }
+
+// The role resource type is for IAM roles, managed policies, Azure role definitions and GCP roles found on the
+// access paths of synced resources.
+var roleResourceType = &v2.ResourceType{
+	Id:          "role",
+	DisplayName: "Role",
+	Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_ROLE},
+}
+
+// The issue resource type is for open Wiz issues affecting synced resources, which are their parents.
+var issueResourceType = &v2.ResourceType{
+	Id:          "wiz_issue",
+	DisplayName: "Wiz Issue",
+}
+
+// The tenant resource type is for the Wiz tenants synced by one connector, parents of everything synced from them.
+var tenantResourceType = &v2.ResourceType{
+	Id:          "wiz_tenant",
+	DisplayName: "Wiz Tenant",
+	Annotations: annotations.New(&v2.SkipEntitlementsAndGrants{}),
+}
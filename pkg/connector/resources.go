@@ -2,7 +2,11 @@ package connector
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
+	"sort"
 	"strings"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
@@ -12,11 +16,25 @@ import (
 	sdkGrant "github.com/conductorone/baton-sdk/pkg/types/grant"
 	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/conductorone/baton-wiz/pkg/client"
+	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 type resourceBuilder struct {
 	client           *client.Client
+	identity         *identityResolver
 	externalSyncMode bool
+	syncRoles        bool
+	markSensitive    bool
+	securityContext  bool
+	syncIssues       bool
+	typeMappings     *resourceTypeMappings
+	taxonomy         *accessTaxonomy
+	// classifier assigns access levels to permissions when marking privileged entitlements, even when entitlements
+	// are not normalized.
+	classifier *accessTaxonomy
 }
 
 func (o *resourceBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
@@ -30,13 +48,72 @@ func (o *resourceBuilder) List(ctx context.Context, parentResourceID *v2.Resourc
 		return nil, "", nil, err
 	}
 
+	var sensitivity map[string]*dataSensitivityFindings
+	if o.markSensitive {
+		var ids []string
+		for _, n := range resources.Data.GraphSearch.Nodes {
+			for _, e := range n.Entities {
+				ids = append(ids, e.Id)
+			}
+		}
+		sensitivity, err = loadDataSensitivity(ctx, o.client, ids)
+		if err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	var securityContexts map[string]*securityContext
+	if o.securityContext {
+		entities := make(map[string]client.ResourceProperties)
+		for _, n := range resources.Data.GraphSearch.Nodes {
+			for _, e := range n.Entities {
+				entities[e.Id] = e.Properties
+			}
+		}
+		securityContexts, err = loadSecurityContexts(ctx, o.client, entities)
+		if err != nil {
+			return nil, "", nil, err
+		}
+	}
+
 	for _, n := range resources.Data.GraphSearch.Nodes {
 		for _, accessibleResource := range n.Entities {
-			displayName := fmt.Sprintf("%s %s", accessibleResource.Name, strings.ToLower(accessibleResource.Type))
+			entity, err := entityAnnotation(&accessibleResource)
+			if err != nil {
+				return nil, "", nil, err
+			}
+			resourceOpts := []rs.ResourceOption{rs.WithAnnotation(entity)}
+			if len(accessibleResource.Scopes) != 0 {
+				scopes, err := structpb.NewStruct(map[string]interface{}{
+					"scopes": stringsToInterfaces(accessibleResource.Scopes),
+				})
+				if err != nil {
+					return nil, "", nil, err
+				}
+				resourceOpts = append(resourceOpts, rs.WithAnnotation(scopes))
+			}
+			if o.syncIssues {
+				resourceOpts = append(resourceOpts, rs.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: issueResourceType.Id}))
+			}
+			if findings, ok := sensitivity[accessibleResource.Id]; ok {
+				annotation, err := dataSensitivityAnnotation(findings)
+				if err != nil {
+					return nil, "", nil, err
+				}
+				resourceOpts = append(resourceOpts, rs.WithAnnotation(annotation))
+			}
+			if sc, ok := securityContexts[accessibleResource.Id]; ok {
+				annotation, err := keyedAnnotation(SecurityContextKey, sc.metadata())
+				if err != nil {
+					return nil, "", nil, err
+				}
+				resourceOpts = append(resourceOpts, rs.WithAnnotation(annotation))
+			}
 			resource, err := rs.NewResource(
-				displayName,
+				o.typeMappings.displayName(&accessibleResource),
 				wizQueryResourceType,
 				accessibleResource.Id,
+				resourceOpts...,
 			)
 			if err != nil {
 				return nil, "", nil, err
@@ -45,89 +122,402 @@ func (o *resourceBuilder) List(ctx context.Context, parentResourceID *v2.Resourc
 		}
 	}
 
+	if nextPageToken == "" {
+		logExclusions(ctx, o.client)
+	}
+
 	return rv, nextPageToken, nil, nil
 }
 
+// resourceTypeMappings maps Wiz entity types to the label used in resource display names. Sync profile scopes can
+// set their own mapping for the resources they list.
+type resourceTypeMappings struct {
+	mapping map[string]string
+	scopes  map[string]map[string]string
+}
+
+func newResourceTypeMappings(mapping map[string]string, scopes []*ProfileScope) *resourceTypeMappings {
+	m := &resourceTypeMappings{mapping: mapping, scopes: make(map[string]map[string]string)}
+	for _, s := range scopes {
+		if len(s.ResourceTypeMapping) != 0 {
+			m.scopes[s.Name] = s.ResourceTypeMapping
+		}
+	}
+	return m
+}
+
+// displayName names the resource with the type mapping of the scope that listed it.
+func (m *resourceTypeMappings) displayName(entity *client.GraphEntity) string {
+	mapping := m.mapping
+	if scopeMapping, ok := m.scopes[entity.ListedBy()]; ok {
+		mapping = scopeMapping
+	}
+	return resourceDisplayName(entity, mapping)
+}
+
+// resourceDisplayName names the resource after the Wiz entity and its type label, e.g. "logs s3 bucket".
+func resourceDisplayName(entity *client.GraphEntity, resourceTypeMapping map[string]string) string {
+	typeLabel, ok := resourceTypeMapping[entity.Type]
+	if !ok {
+		typeLabel = strings.ToLower(entity.Type)
+	}
+	return fmt.Sprintf("%s %s", entity.Name, typeLabel)
+}
+
+// entityAnnotation records the Wiz entity type of the resource and, when resource properties were read, its cloud
+// account, so that exports from a sync can report them. See ResourceEntity.
+func entityAnnotation(entity *client.GraphEntity) (*structpb.Struct, error) {
+	return keyedAnnotation(resourceEntityKey, &resourceEntity{
+		Type:             entity.Type,
+		CloudPlatform:    entity.Properties.CloudPlatform,
+		CloudAccount:     entity.Properties.SubscriptionExternalId,
+		CloudAccountName: entity.Properties.SubscriptionName,
+	})
+}
+
+// logExclusions reports how many resources and principals exclusion rules have dropped so far.
+func logExclusions(ctx context.Context, c *client.Client) {
+	resources, principals := c.ExclusionCounts()
+	if resources == 0 && principals == 0 {
+		return
+	}
+	ctxzap.Extract(ctx).Info("wiz-connector: excluded resources and principals",
+		zap.Int("excluded_resources", resources),
+		zap.Int("excluded_principals", principals))
+}
+
+// entitlementsPageToken carries the distinct permissions seen on earlier effective access pages, so entitlements
+// are emitted once per resource even when a sync resumes part way through.
+type entitlementsPageToken struct {
+	Token       string   `json:"token"`
+	Permissions []string `json:"permissions,omitempty"`
+	// PrivilegeLevels holds the highest privilege level Wiz reported for each permission, when above standard.
+	PrivilegeLevels map[string]string `json:"privilege_levels,omitempty"`
+}
+
+// Entitlements aggregates the distinct permissions across every effective access page and granted entity type of
+// the resource, then emits one entitlement per permission (or access level) on the last page.
 func (o *resourceBuilder) Entitlements(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
-	var rv []*v2.Entitlement
-	resourcePermissions, nextPageToken, err := o.client.ListResourcePermissions(ctx, resource.Id.Resource, pToken)
+	pageToken := &entitlementsPageToken{}
+	if pToken.Token != "" {
+		err := json.Unmarshal([]byte(pToken.Token), pageToken)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("wiz-connector: error parsing entitlements page token: %w", err)
+		}
+	}
+
+	resourcePermissions, nextPageToken, err := o.client.ListResourceEffectiveAccess(ctx, resource.Id.Resource, &pagination.Token{Token: pageToken.Token})
 	if err != nil {
 		return nil, "", nil, err
 	}
-	nodes := resourcePermissions.Data.EntityEffectiveAccessEntries.Nodes
-	for _, n := range nodes {
-		for _, p := range n.Permissions {
-			ent := o.resourceEntitlement(resource, p)
-			rv = append(rv, ent)
+
+	permissions := mapset.NewSet[string](pageToken.Permissions...)
+	privilegeLevels := pageToken.PrivilegeLevels
+	if privilegeLevels == nil {
+		privilegeLevels = make(map[string]string)
+	}
+	for _, n := range resourcePermissions.Data.EntityEffectiveAccessEntries.Nodes {
+		permissions.Append(n.Permissions...)
+		if level := wizPrivilegeLevel(n.AccessTypes); level != PrivilegeLevelStandard {
+			for _, p := range n.Permissions {
+				privilegeLevels[p] = maxPrivilegeLevel(privilegeLevels[p], level)
+			}
 		}
 	}
-	return rv, nextPageToken, nil, nil
+	distinctPermissions := permissions.ToSlice()
+	sort.Strings(distinctPermissions)
+
+	if nextPageToken != "" {
+		next, err := json.Marshal(&entitlementsPageToken{
+			Token:           nextPageToken,
+			Permissions:     distinctPermissions,
+			PrivilegeLevels: privilegeLevels,
+		})
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return nil, string(next), nil, nil
+	}
+
+	var rv []*v2.Entitlement
+	names, rawPermissions := o.entitlementNames(distinctPermissions)
+	for _, name := range names {
+		details := &entitlementDetails{rawPermissions: rawPermissions[name]}
+		if o.markSensitive {
+			o.markEntitlementSensitivity(details, resource, name, privilegeLevels)
+		}
+		ent, err := o.resourceEntitlement(resource, name, details)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		rv = append(rv, ent)
+	}
+	return rv, "", nil, nil
+}
+
+// markEntitlementSensitivity sets the entitlement's privilege level from Wiz's access types and the access levels of
+// its permissions, and its data sensitivity from the resource's data findings.
+func (o *resourceBuilder) markEntitlementSensitivity(details *entitlementDetails, resource *v2.Resource, name string, privilegeLevels map[string]string) {
+	permissions := details.rawPermissions
+	if permissions == nil {
+		permissions = []string{name}
+	}
+
+	level := PrivilegeLevelStandard
+	for _, p := range permissions {
+		level = maxPrivilegeLevel(level, privilegeLevels[p])
+		for _, accessLevel := range o.classifier.Levels(p) {
+			level = maxPrivilegeLevel(level, accessLevelPrivilegeLevel(accessLevel))
+		}
+	}
+	details.privilegeLevel = level
+	details.dataSensitivity, details.sensitiveDataTypes = resourceDataSensitivity(resource)
 }
 
+// Grants returns a grant of each entitlement to each principal with access to the resource, resolved with the
+// identity settings of the scope that listed the resource. With identity correlation several accounts can resolve to
+// the same user, so the resource's effective access is read in one call and each grant is emitted once, naming every
+// account the user holds it through.
 func (o *resourceBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
-	var rv []*v2.Grant
-	resourcePermissions, nextPageToken, err := o.client.ListResourcePermissionEffectiveAccess(ctx, resource.Id.Resource, pToken)
+	nodes, scope, nextPageToken, err := o.effectiveAccess(ctx, resource, pToken)
 	if err != nil {
 		return nil, "", nil, err
 	}
+	identity := o.identity.forScope(scope)
 
-	nodes := resourcePermissions.Data.EntityEffectiveAccessEntries.Nodes
+	var grants []*resourceGrant
+	byKey := make(map[string]*resourceGrant)
+	roleGrantsSeen := make(map[string]bool)
+	var rv []*v2.Grant
 	for _, n := range nodes {
 		grantedEntity := n.GrantedEntity
 		if grantedEntity == nil {
 			continue
 		}
 
-		var resourceType string
-		if grantedEntity.Type == client.GrantedEntityTypeGroup {
-			resourceType = groupResourceType.Id
-		} else {
-			resourceType = userResourceType.Id
+		principal, grantOpts, ok, err := grantPrincipal(ctx, identity, o.externalSyncMode, grantedEntity)
+		if err != nil {
+			return nil, "", nil, err
 		}
-
-		principal := &v2.ResourceId{
-			ResourceType: resourceType,
-			Resource:     grantedEntity.Id,
+		if !ok {
+			continue
 		}
 
-		grantOpts := make([]sdkGrant.GrantOption, 0)
-		if o.externalSyncMode {
-			// TODO(lauren) do we want to exclude entities with no external id when in this mode?
-			// If so, consider adding a filter to graphql query
-			if grantedEntity.Properties.ExternalId == "" {
+		pathMetadata := accessPathMetadata(grantedEntity, n.AccessPath, resource)
+		names, rawPermissions := o.entitlementNames(n.Permissions)
+
+		for _, p := range names {
+			key := p + ":" + principal.Resource
+			if g, ok := byKey[key]; ok {
+				g.accounts = append(g.accounts, grantedEntity)
 				continue
 			}
-			grantOpts = append(grantOpts, sdkGrant.WithAnnotation(&v2.ExternalResourceMatchID{
-				Id: grantedEntity.Properties.ExternalId,
-			}))
-		} else {
-			if grantedEntity.Properties.PrimaryEmail != "" {
-				principal.Resource = grantedEntity.Properties.PrimaryEmail
-			} else if grantedEntity.Properties.Email != "" {
-				principal.Resource = grantedEntity.Properties.Email
+
+			metadata := make(map[string]interface{})
+			maps.Copy(metadata, pathMetadata)
+			if raw, ok := rawPermissions[p]; ok {
+				metadata[GrantMetadataPermissions] = stringsToInterfaces(raw)
+			}
+			g := &resourceGrant{
+				entitlement: p,
+				principal:   principal,
+				opts:        grantOpts,
+				metadata:    metadata,
+				accounts:    []*client.GrantedEntity{grantedEntity},
 			}
+			byKey[key] = g
+			grants = append(grants, g)
 		}
 
-		for _, p := range n.Permissions {
-			rv = append(rv, sdkGrant.NewGrant(resource, p, principal, grantOpts...))
+		if o.syncRoles {
+			rv = append(rv, roleGrants(resource, n.AccessPath, names, roleGrantsSeen)...)
 		}
 	}
 
+	for _, g := range grants {
+		if o.identity.correlator != nil {
+			maps.Copy(g.metadata, viaMetadata(g.accounts))
+		}
+		opts := g.opts
+		if len(g.metadata) != 0 {
+			opts = append(slices.Clone(g.opts), sdkGrant.WithGrantMetadata(g.metadata))
+		}
+		rv = append(rv, sdkGrant.NewGrant(resource, g.entitlement, g.principal, opts...))
+	}
+
 	return rv, nextPageToken, nil, nil
 }
 
-func (o *resourceBuilder) resourceEntitlement(resource *v2.Resource, accessType string) *v2.Entitlement {
+// resourceGrant is a grant of a resource entitlement being built, with the accounts it was observed through.
+type resourceGrant struct {
+	entitlement string
+	principal   *v2.ResourceId
+	opts        []sdkGrant.GrantOption
+	metadata    map[string]interface{}
+	accounts    []*client.GrantedEntity
+}
+
+// effectiveAccess returns a page of the resource's effective access, or all of it when identities are correlated,
+// along with the scope that listed the resource.
+func (o *resourceBuilder) effectiveAccess(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]client.EffectiveAccessEntry, string, string, error) {
+	if o.identity.correlator == nil {
+		page, nextPageToken, err := o.client.ListResourceEffectiveAccess(ctx, resource.Id.Resource, pToken)
+		if err != nil {
+			return nil, "", "", err
+		}
+		return page.Data.EntityEffectiveAccessEntries.Nodes, page.Scope, nextPageToken, nil
+	}
+
+	var nodes []client.EffectiveAccessEntry
+	token := &pagination.Token{}
+	for {
+		page, nextPageToken, err := o.client.ListResourceEffectiveAccess(ctx, resource.Id.Resource, token)
+		if err != nil {
+			return nil, "", "", err
+		}
+		nodes = append(nodes, page.Data.EntityEffectiveAccessEntries.Nodes...)
+		if nextPageToken == "" {
+			return nodes, page.Scope, "", nil
+		}
+		token = &pagination.Token{Token: nextPageToken}
+	}
+}
+
+// grantPrincipal returns the principal and grant options for a granted entity. It reports false for entities that
+// cannot be matched in external sync mode.
+func grantPrincipal(ctx context.Context, identity *identityResolver, externalSyncMode bool, grantedEntity *client.GrantedEntity) (*v2.ResourceId, []sdkGrant.GrantOption, bool, error) {
+	var resourceType string
+	if grantedEntity.Type == client.GrantedEntityTypeGroup {
+		resourceType = groupResourceType.Id
+	} else {
+		resourceType = userResourceType.Id
+	}
+
+	principal := &v2.ResourceId{
+		ResourceType: resourceType,
+		Resource:     grantedEntity.Id,
+	}
+
+	identity.report.recordPrincipal(grantedEntity)
+
+	grantOpts := make([]sdkGrant.GrantOption, 0)
+	if externalSyncMode {
+		// TODO(lauren) do we want to exclude entities with no external id when in this mode?
+		// If so, consider adding a filter to graphql query
+		if grantedEntity.Properties.ExternalId == "" {
+			identity.report.skipPrincipal(grantedEntity, skipReasonMissingExternalID)
+			return nil, nil, false, nil
+		}
+		grantOpts = append(grantOpts, sdkGrant.WithAnnotation(&v2.ExternalResourceMatchID{
+			Id: grantedEntity.Properties.ExternalId,
+		}))
+	} else {
+		userId, err := identity.Resolve(ctx, grantedEntity)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		principal.Resource = userId
+	}
+
+	return principal, grantOpts, true, nil
+}
+
+// roleGrants grants the resource permissions to the role access flows through, expandable to every principal
+// assigned the role, so the graph shows how access is granted. seen de-duplicates grants within a page.
+func roleGrants(resource *v2.Resource, path []*client.AccessPathEntity, permissions []string, seen map[string]bool) []*v2.Grant {
+	role := grantingRole(path)
+	if role == nil {
+		return nil
+	}
+
+	principal := &v2.ResourceId{ResourceType: roleResourceType.Id, Resource: role.Id}
+	var rv []*v2.Grant
+	for _, p := range permissions {
+		key := role.Id + ":" + p
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		rv = append(rv, sdkGrant.NewGrant(resource, p, principal, sdkGrant.WithAnnotation(&v2.GrantExpandable{
+			EntitlementIds: []string{roleAssignedEntitlementID(role.Id)},
+		})))
+	}
+	return rv
+}
+
+// entitlementNames returns the entitlements the permissions are granted through in a stable order. When access
+// levels are normalized, it also returns the raw permissions behind each access level.
+func (o *resourceBuilder) entitlementNames(permissions []string) ([]string, map[string][]string) {
+	if o.taxonomy == nil {
+		return permissions, nil
+	}
+	grouped := o.taxonomy.Group(permissions)
+	return slices.Sorted(maps.Keys(grouped)), grouped
+}
+
+func (o *resourceBuilder) resourceEntitlement(resource *v2.Resource, accessType string, details *entitlementDetails) (*v2.Entitlement, error) {
 	grantableTo := []*v2.ResourceType{userResourceType}
 	if o.externalSyncMode {
 		grantableTo = append(grantableTo, groupResourceType)
 	}
-	return sdkEntitlement.NewPermissionEntitlement(resource, accessType,
+	if o.syncRoles {
+		grantableTo = append(grantableTo, roleResourceType)
+	}
+
+	description := fmt.Sprintf("Has %s access on the %s resource", accessType, resource.DisplayName)
+	if details.rawPermissions != nil {
+		description = fmt.Sprintf("%s through %s", description, strings.Join(details.rawPermissions, ", "))
+	}
+	if qualifiers := details.qualifiers(); qualifiers != "" {
+		description = fmt.Sprintf("%s (%s)", description, qualifiers)
+	}
+
+	entOpts := []sdkEntitlement.EntitlementOption{
 		sdkEntitlement.WithGrantableTo(grantableTo...),
 		sdkEntitlement.WithDisplayName(fmt.Sprintf("%s Resource", resource.DisplayName)),
-		sdkEntitlement.WithDescription(fmt.Sprintf("Has %s access on the %s resource", accessType, resource.DisplayName)),
-	)
+		sdkEntitlement.WithDescription(description),
+	}
+	if md := details.metadata(accessType); md != nil {
+		st, err := keyedAnnotation(EntitlementMetadataKey, md)
+		if err != nil {
+			return nil, err
+		}
+		entOpts = append(entOpts, sdkEntitlement.WithAnnotation(st))
+	}
+
+	ent := sdkEntitlement.NewPermissionEntitlement(resource, accessType, entOpts...)
+	if details.privileged() || details.sensitive() {
+		var tags []string
+		if details.privileged() {
+			tags = append(tags, "privileged")
+		}
+		if details.sensitive() {
+			tags = append(tags, "sensitive data")
+		}
+		ent.Slug = fmt.Sprintf("%s (%s)", accessType, strings.Join(tags, ", "))
+	}
+	return ent, nil
 }
 
-func newResourceBuilder(client *client.Client, externalSyncMode bool) *resourceBuilder {
-	return &resourceBuilder{client: client, externalSyncMode: externalSyncMode}
+func stringsToInterfaces(values []string) []interface{} {
+	rv := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		rv = append(rv, v)
+	}
+	return rv
+}
+
+func newResourceBuilder(client *client.Client, config *Config, identity *identityResolver, typeMappings *resourceTypeMappings, taxonomy *accessTaxonomy, classifier *accessTaxonomy) *resourceBuilder {
+	return &resourceBuilder{
+		client:           client,
+		identity:         identity,
+		externalSyncMode: config.ExternalSyncMode,
+		syncRoles:        config.SyncRoles,
+		markSensitive:    config.MarkSensitiveEntitlements,
+		securityContext:  config.EnrichSecurityContext,
+		syncIssues:       config.SyncIssues,
+		typeMappings:     typeMappings,
+		taxonomy:         taxonomy,
+		classifier:       classifier,
+	}
 }
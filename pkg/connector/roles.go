@@ -0,0 +1,149 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	sdkEntitlement "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	sdkGrant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-wiz/pkg/client"
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+const roleAssignedEntitlement = "assigned"
+
+// isRoleStep reports whether an access path hop is modeled as a role resource.
+func isRoleStep(step *client.AccessPathEntity) bool {
+	return step.Type == client.AccessPathEntityTypeAccessRole || step.Type == client.AccessPathEntityTypeRawAccessPolicy
+}
+
+// grantingRole returns the role or policy closest to the resource on the access path, which is the one actually
+// granting the permission, or nil when access does not flow through a role.
+func grantingRole(path []*client.AccessPathEntity) *client.AccessPathEntity {
+	for i := len(path) - 1; i >= 0; i-- {
+		if isRoleStep(path[i]) {
+			return path[i]
+		}
+	}
+	return nil
+}
+
+func roleAssignedEntitlementID(roleID string) string {
+	return sdkEntitlement.NewEntitlementID(&v2.Resource{
+		Id: &v2.ResourceId{ResourceType: roleResourceType.Id, Resource: roleID},
+	}, roleAssignedEntitlement)
+}
+
+type roleBuilder struct {
+	client           *client.Client
+	identity         *identityResolver
+	externalSyncMode bool
+}
+
+func (o *roleBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return roleResourceType
+}
+
+// List walks the effective access of the synced resources and returns every role and policy on their access paths.
+// A role on the access paths of several pages is returned once per page.
+func (o *roleBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var rv []*v2.Resource
+	accessPaths, nextPageToken, err := o.client.ListAccessPathsForResources(ctx, pToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, n := range accessPaths.Data.EntityEffectiveAccessEntries.Nodes {
+		if n.GrantedEntity == nil {
+			continue
+		}
+		for _, step := range n.AccessPath {
+			if !isRoleStep(step) || seen[step.Id] {
+				continue
+			}
+			seen[step.Id] = true
+
+			resource, err := roleResource(step)
+			if err != nil {
+				return nil, "", nil, err
+			}
+			rv = append(rv, resource)
+		}
+	}
+
+	return rv, nextPageToken, nil, nil
+}
+
+func roleResource(role *client.AccessPathEntity) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"role_id":        role.Id,
+		"role_name":      role.Name,
+		"role_type":      role.Type,
+		"native_type":    role.Properties.NativeType,
+		"cloud_platform": role.Properties.CloudPlatform,
+	}
+
+	return rs.NewRoleResource(
+		role.Name,
+		roleResourceType,
+		role.Id,
+		[]rs.RoleTraitOption{rs.WithRoleProfile(profile)},
+	)
+}
+
+func (o *roleBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	grantableTo := []*v2.ResourceType{userResourceType}
+	if o.externalSyncMode {
+		grantableTo = append(grantableTo, groupResourceType)
+	}
+	ent := sdkEntitlement.NewAssignmentEntitlement(resource, roleAssignedEntitlement,
+		sdkEntitlement.WithGrantableTo(grantableTo...),
+		sdkEntitlement.WithDisplayName(fmt.Sprintf("%s Role", resource.DisplayName)),
+		sdkEntitlement.WithDescription(fmt.Sprintf("Assigned the %s role", resource.DisplayName)),
+	)
+	return []*v2.Entitlement{ent}, "", nil, nil
+}
+
+// Grants returns the principals whose access flows through the role, read from Wiz's effective access keyed by the
+// role, so grants do not depend on which resources were listed before. A principal reaching several resources
+// through the role is granted it once per page; the grants of later pages share their IDs, so the sync stores each
+// principal's grant once without the page token carrying the principals already granted. Role access is not read
+// through a scope's resources, so principals are resolved the way every scope resolves them, see
+// identityResolver.unscoped.
+func (o *roleBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	access, nextPageToken, err := o.client.ListRoleEffectiveAccess(ctx, resource.Id.Resource, pToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	granted := mapset.NewThreadUnsafeSet[string]()
+	var rv []*v2.Grant
+	for _, n := range access.Data.EntityEffectiveAccessEntries.Nodes {
+		if n.GrantedEntity == nil {
+			continue
+		}
+		principal, grantOpts, ok, err := grantPrincipal(ctx, o.identity, o.externalSyncMode, n.GrantedEntity)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if !ok || !granted.Add(principal.ResourceType+":"+principal.Resource) {
+			continue
+		}
+		rv = append(rv, sdkGrant.NewGrant(resource, roleAssignedEntitlement, principal, grantOpts...))
+	}
+
+	return rv, nextPageToken, nil, nil
+}
+
+func newRoleBuilder(client *client.Client, identity *identityResolver, externalSyncMode bool) *roleBuilder {
+	return &roleBuilder{
+		client:           client,
+		identity:         identity,
+		externalSyncMode: externalSyncMode,
+	}
+}
@@ -0,0 +1,125 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/conductorone/baton-wiz/pkg/client"
+)
+
+// issueSeverities are the Wiz issue severities, most severe first.
+var issueSeverities = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "INFORMATIONAL"}
+
+// securityContext summarizes what Wiz knows about the risk of a resource, so reviewers can weigh access to it.
+type securityContext struct {
+	internetExposed         bool
+	openIssues              map[string]int
+	toxicCombinations       int
+	criticalVulnerabilities int
+}
+
+// loadSecurityContexts fetches the open issues and critical vulnerabilities of a page of resources in one batch per
+// query, keyed by resource id.
+func loadSecurityContexts(ctx context.Context, c *client.Client, entities map[string]client.ResourceProperties) (map[string]*securityContext, error) {
+	ids := make([]string, 0, len(entities))
+	contexts := make(map[string]*securityContext, len(entities))
+	for id, props := range entities {
+		ids = append(ids, id)
+		contexts[id] = &securityContext{
+			internetExposed: props.IsAccessibleFromInternet,
+			openIssues:      make(map[string]int),
+		}
+	}
+	if len(ids) == 0 {
+		return contexts, nil
+	}
+
+	issues, err := c.ListOpenIssuesForEntities(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range issues {
+		sc, ok := contexts[issue.EntitySnapshot.Id]
+		if !ok {
+			continue
+		}
+		sc.openIssues[issue.Severity]++
+		if issue.Type == client.IssueTypeToxicCombination {
+			sc.toxicCombinations++
+		}
+	}
+
+	findings, err := c.ListCriticalVulnerabilitiesForAssets(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, finding := range findings {
+		if sc, ok := contexts[finding.VulnerableAsset.Id]; ok {
+			sc.criticalVulnerabilities++
+		}
+	}
+
+	return contexts, nil
+}
+
+// summary describes the security context in one line, e.g.
+// "internet exposed; open issues: 1 critical, 2 high; 1 toxic combination; 3 critical vulnerabilities".
+func (sc *securityContext) summary() string {
+	var parts []string
+	if sc.internetExposed {
+		parts = append(parts, "internet exposed")
+	}
+
+	var issues []string
+	for _, severity := range issueSeverities {
+		if n := sc.openIssues[severity]; n != 0 {
+			issues = append(issues, fmt.Sprintf("%d %s", n, strings.ToLower(severity)))
+		}
+	}
+	if len(issues) != 0 {
+		parts = append(parts, "open issues: "+strings.Join(issues, ", "))
+	}
+
+	if sc.toxicCombinations != 0 {
+		parts = append(parts, pluralize(sc.toxicCombinations, "toxic combination"))
+	}
+	if sc.criticalVulnerabilities != 0 {
+		parts = append(parts, pluralize(sc.criticalVulnerabilities, "critical vulnerability", "critical vulnerabilities"))
+	}
+
+	if len(parts) == 0 {
+		return "no open Wiz issues or critical vulnerabilities"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// metadata returns the security context recorded on the resource.
+func (sc *securityContext) metadata() *SecurityContext {
+	openIssues := make(map[string]int, len(issueSeverities))
+	total := 0
+	for _, severity := range issueSeverities {
+		openIssues[strings.ToLower(severity)] = sc.openIssues[severity]
+		total += sc.openIssues[severity]
+	}
+
+	return &SecurityContext{
+		InternetExposed:         sc.internetExposed,
+		OpenIssues:              openIssues,
+		OpenIssueCount:          total,
+		ToxicCombinations:       sc.toxicCombinations,
+		CriticalVulnerabilities: sc.criticalVulnerabilities,
+		Summary:                 sc.summary(),
+	}
+}
+
+// pluralize returns "1 thing" or "2 things", using the explicit plural when one is given.
+func pluralize(n int, singular string, plural ...string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	if len(plural) != 0 {
+		return fmt.Sprintf("%d %s", n, plural[0])
+	}
+	return fmt.Sprintf("%d %ss", n, singular)
+}
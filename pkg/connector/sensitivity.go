@@ -0,0 +1,247 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-wiz/pkg/client"
+	mapset "github.com/deckarep/golang-set/v2"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	PrivilegeLevelAdmin    = "admin"
+	PrivilegeLevelHigh     = "high"
+	PrivilegeLevelStandard = "standard"
+
+	DataSensitivitySensitive = "sensitive"
+	DataSensitivityNone      = "none"
+	// DataSensitivityUnknown is the sensitivity of resources synced without reading their data findings.
+	DataSensitivityUnknown = "unknown"
+)
+
+// dataSensitivityKey holds the dataSensitivityFindings of a resource.
+const dataSensitivityKey = "wiz_data_sensitivity"
+
+// dataSensitivityFindings summarizes Wiz's data findings for a resource, recorded when it is listed so entitlements can
+// be marked later in the sync.
+type dataSensitivityFindings struct {
+	DataSensitivity    string   `json:"data_sensitivity"`
+	SensitiveDataTypes []string `json:"sensitive_data_types,omitempty"`
+}
+
+var privilegeLevelRank = map[string]int{
+	PrivilegeLevelStandard: 0,
+	PrivilegeLevelHigh:     1,
+	PrivilegeLevelAdmin:    2,
+}
+
+// maxPrivilegeLevel returns the higher of the two privilege levels.
+func maxPrivilegeLevel(a string, b string) string {
+	if privilegeLevelRank[b] > privilegeLevelRank[a] {
+		return b
+	}
+	if a == "" {
+		return PrivilegeLevelStandard
+	}
+	return a
+}
+
+// wizPrivilegeLevel maps the access types Wiz reports for an effective access entry to a privilege level.
+func wizPrivilegeLevel(accessTypes []string) string {
+	level := PrivilegeLevelStandard
+	for _, at := range accessTypes {
+		at = strings.ToUpper(at)
+		switch {
+		case strings.Contains(at, "ADMIN"):
+			level = maxPrivilegeLevel(level, PrivilegeLevelAdmin)
+		case strings.Contains(at, "HIGH"), strings.Contains(at, "PERMISSIONS_MANAGEMENT"):
+			level = maxPrivilegeLevel(level, PrivilegeLevelHigh)
+		}
+	}
+	return level
+}
+
+// accessLevelPrivilegeLevel maps a normalized access level to a privilege level.
+func accessLevelPrivilegeLevel(accessLevel string) string {
+	switch accessLevel {
+	case AccessLevelAdmin:
+		return PrivilegeLevelAdmin
+	case AccessLevelPermissionsManagement:
+		return PrivilegeLevelHigh
+	default:
+		return PrivilegeLevelStandard
+	}
+}
+
+// dataCategoryLabels name the categories of Wiz data classifiers in entitlement descriptions. Other categories are
+// named in lower case.
+var dataCategoryLabels = map[string]string{
+	"PII":       "PII",
+	"PHI":       "PHI",
+	"PCI":       "financial",
+	"FINANCIAL": "financial",
+	"SECRETS":   "secrets",
+}
+
+// loadDataSensitivity fetches the data findings of a page of resources in one batch and summarizes them per resource
+// id. Resources Wiz has no data findings for are not sensitive, including those its data scanning does not cover.
+func loadDataSensitivity(ctx context.Context, c *client.Client, ids []string) (map[string]*dataSensitivityFindings, error) {
+	findings := make(map[string][]*client.DataFinding, len(ids))
+	for _, id := range ids {
+		findings[id] = nil
+	}
+	if len(ids) != 0 {
+		dataFindings, err := c.ListDataFindingsForEntities(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range dataFindings {
+			if _, ok := findings[f.GraphEntity.Id]; ok {
+				findings[f.GraphEntity.Id] = append(findings[f.GraphEntity.Id], f)
+			}
+		}
+	}
+
+	rv := make(map[string]*dataSensitivityFindings, len(findings))
+	for id, f := range findings {
+		rv[id] = dataSensitivity(f)
+	}
+	return rv, nil
+}
+
+// dataSensitivity summarizes the data findings of a resource: it is sensitive when it has any, with the categories
+// of the data found.
+func dataSensitivity(findings []*client.DataFinding) *dataSensitivityFindings {
+	if len(findings) == 0 {
+		return &dataSensitivityFindings{DataSensitivity: DataSensitivityNone}
+	}
+	dataTypes := mapset.NewThreadUnsafeSet[string]()
+	for _, f := range findings {
+		category := strings.ToUpper(f.DataClassifier.Category)
+		if category == "" {
+			continue
+		}
+		label, ok := dataCategoryLabels[category]
+		if !ok {
+			label = strings.ToLower(strings.ReplaceAll(category, "_", " "))
+		}
+		dataTypes.Add(label)
+	}
+	sensitiveDataTypes := dataTypes.ToSlice()
+	sort.Strings(sensitiveDataTypes)
+	return &dataSensitivityFindings{
+		DataSensitivity:    DataSensitivitySensitive,
+		SensitiveDataTypes: sensitiveDataTypes,
+	}
+}
+
+// dataSensitivityAnnotation records the resource's data sensitivity so entitlements can be marked later in the sync.
+func dataSensitivityAnnotation(findings *dataSensitivityFindings) (*structpb.Struct, error) {
+	return keyedAnnotation(dataSensitivityKey, findings)
+}
+
+// resourceDataSensitivity reads back the data sensitivity recorded on the resource when it was listed.
+func resourceDataSensitivity(resource *v2.Resource) (string, []string) {
+	findings := &dataSensitivityFindings{}
+	if !findKeyedAnnotation(resource.GetAnnotations(), dataSensitivityKey, findings) {
+		return DataSensitivityUnknown, nil
+	}
+	return findings.DataSensitivity, findings.SensitiveDataTypes
+}
+
+// entitlementDetails carries what an entitlement is annotated with beyond its name.
+type entitlementDetails struct {
+	// rawPermissions are the provider-native permissions behind a normalized access level.
+	rawPermissions []string
+	// privilegeLevel and data sensitivity are only set when sensitive entitlements are marked.
+	privilegeLevel     string
+	dataSensitivity    string
+	sensitiveDataTypes []string
+}
+
+func (d *entitlementDetails) privileged() bool {
+	return d.privilegeLevel == PrivilegeLevelAdmin || d.privilegeLevel == PrivilegeLevelHigh
+}
+
+func (d *entitlementDetails) sensitive() bool {
+	return d.dataSensitivity == DataSensitivitySensitive
+}
+
+// qualifiers describes the privilege and data sensitivity, e.g. "admin privilege, sensitive data: PII".
+func (d *entitlementDetails) qualifiers() string {
+	var q []string
+	if d.privileged() {
+		q = append(q, fmt.Sprintf("%s privilege", d.privilegeLevel))
+	}
+	if d.sensitive() {
+		if len(d.sensitiveDataTypes) != 0 {
+			q = append(q, fmt.Sprintf("sensitive data: %s", strings.Join(d.sensitiveDataTypes, ", ")))
+		} else {
+			q = append(q, "sensitive data")
+		}
+	}
+	return strings.Join(q, "; ")
+}
+
+// metadata returns what the entitlement records beyond its name, or nil when there is nothing to record.
+func (d *entitlementDetails) metadata(accessType string) *EntitlementMetadata {
+	if d.rawPermissions == nil && d.privilegeLevel == "" {
+		return nil
+	}
+	md := &EntitlementMetadata{
+		Permission:         accessType,
+		PrivilegeLevel:     d.privilegeLevel,
+		DataSensitivity:    d.dataSensitivity,
+		SensitiveDataTypes: d.sensitiveDataTypes,
+	}
+	if d.rawPermissions != nil {
+		md.AccessLevel = accessType
+		md.Permissions = d.rawPermissions
+	}
+	return md
+}
+
+// PrivilegeClassifier tells the privilege level of synced resource entitlements.
+type PrivilegeClassifier struct {
+	taxonomy *accessTaxonomy
+}
+
+// NewPrivilegeClassifier classifies entitlements with the access level rules in the taxonomy file, or the default
+// rules when none is given. It should be given the --access-taxonomy-file of the sync.
+func NewPrivilegeClassifier(taxonomyFile string) (*PrivilegeClassifier, error) {
+	taxonomy, err := newAccessTaxonomy(taxonomyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &PrivilegeClassifier{taxonomy: taxonomy}, nil
+}
+
+// EntitlementPrivilegeLevel returns the privilege level of a synced resource entitlement: the level recorded on it
+// with --mark-sensitive-entitlements, or else the level of its permissions under the access level rules. Only
+// entitlements without metadata are read by their slug, which is then their permission.
+func (c *PrivilegeClassifier) EntitlementPrivilegeLevel(ent *v2.Entitlement) string {
+	permissions := []string{ent.GetSlug()}
+	if md, ok := GetEntitlementMetadata(ent); ok {
+		if md.PrivilegeLevel != "" {
+			return md.PrivilegeLevel
+		}
+		permissions = append([]string{md.Permission, md.AccessLevel}, md.Permissions...)
+	}
+
+	level := PrivilegeLevelStandard
+	for _, p := range permissions {
+		if p == "" {
+			continue
+		}
+		for _, accessLevel := range c.taxonomy.Levels(p) {
+			level = maxPrivilegeLevel(level, accessLevelPrivilegeLevel(accessLevel))
+		}
+		// Access levels are also valid permissions, when entitlements are normalized.
+		level = maxPrivilegeLevel(level, accessLevelPrivilegeLevel(p))
+	}
+	return level
+}
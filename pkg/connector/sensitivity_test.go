@@ -0,0 +1,45 @@
+package connector
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/conductorone/baton-wiz/pkg/client"
+)
+
+func TestDataSensitivity(t *testing.T) {
+	finding := func(category string) *client.DataFinding {
+		f := &client.DataFinding{}
+		f.DataClassifier.Category = category
+		return f
+	}
+	tests := []struct {
+		name          string
+		findings      []*client.DataFinding
+		want          string
+		wantDataTypes []string
+	}{
+		{name: "no findings", want: DataSensitivityNone},
+		{
+			name:          "categories",
+			findings:      []*client.DataFinding{finding("SECRETS"), finding("PII"), finding("PCI"), finding("PII")},
+			want:          DataSensitivitySensitive,
+			wantDataTypes: []string{"PII", "financial", "secrets"},
+		},
+		{
+			name:          "other category",
+			findings:      []*client.DataFinding{finding("DIGITAL_IDENTITY")},
+			want:          DataSensitivitySensitive,
+			wantDataTypes: []string{"digital identity"},
+		},
+		{name: "no category", findings: []*client.DataFinding{finding("")}, want: DataSensitivitySensitive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dataSensitivity(tt.findings)
+			if got.DataSensitivity != tt.want || !slices.Equal(got.SensitiveDataTypes, tt.wantDataTypes) {
+				t.Errorf("dataSensitivity() = %q %q, want %q %q", got.DataSensitivity, got.SensitiveDataTypes, tt.want, tt.wantDataTypes)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+)
+
+const (
+	AccessLevelRead                  = "read"
+	AccessLevelWrite                 = "write"
+	AccessLevelAdmin                 = "admin"
+	AccessLevelDelete                = "delete"
+	AccessLevelList                  = "list"
+	AccessLevelDataAccess            = "data-access"
+	AccessLevelPermissionsManagement = "permissions-management"
+)
+
+// accessLevelRule maps provider-native permissions matching any of the case-insensitive patterns to an access level.
+type accessLevelRule struct {
+	Level    string   `json:"level"`
+	Patterns []string `json:"patterns"`
+
+	compiled []*regexp.Regexp
+}
+
+// defaultAccessLevelRules covers the AWS actions ("s3:GetObject"), Azure actions and role names
+// ("Microsoft.Storage/storageAccounts/read", "Storage Blob Data Reader") and GCP permissions and roles
+// ("storage.objects.get", "roles/viewer") that Wiz reports.
+var defaultAccessLevelRules = []*accessLevelRule{
+	{Level: AccessLevelAdmin, Patterns: []string{`^\*$`, `:\*$`, `/\*$`, `^owner$`, `^roles/owner$`, `administrator`}},
+	{Level: AccessLevelPermissionsManagement, Patterns: []string{
+		`^iam:`, `setiampolicy`, `(attach|detach|put|delete)\w*policy`, `putbucketacl`, `roleassignments/`,
+		`roledefinitions/`, `user access administrator`, `securityadmin`,
+	}},
+	{Level: AccessLevelDataAccess, Patterns: []string{
+		`^s3:(get|put|delete)object`, `dataactions`, `data (reader|contributor|owner)`, `^storage\.objects\.`,
+		`^dynamodb:(getitem|batchgetitem|putitem|query|scan)`, `^bigquery\.tables\.getdata`,
+		`^secretsmanager:getsecretvalue`, `^kms:decrypt`,
+	}},
+	{Level: AccessLevelDelete, Patterns: []string{`delete`, `remove`, `terminate`, `destroy`}},
+	{Level: AccessLevelList, Patterns: []string{`:list`, `\.list$`, `/list`}},
+	{Level: AccessLevelWrite, Patterns: []string{
+		`:(put|create|update|modify|set|add|tag|untag|upload|copy|restore|start|stop|reboot|write)`,
+		`/(write|action)$`, `\.(create|update|patch|set\w*)$`, `contributor`, `writer`, `editor`,
+	}},
+	{Level: AccessLevelRead, Patterns: []string{`:(get|describe|read|head|view|select)`, `/read$`, `\.get$`, `reader`, `viewer`}},
+}
+
+// accessTaxonomy normalizes provider-native permissions into a small set of access levels. Permissions matching no
+// rule keep their raw name, so no access is lost from the sync.
+type accessTaxonomy struct {
+	rules []*accessLevelRule
+}
+
+// newAccessTaxonomy compiles the default rules, or the rules in the taxonomy file when one is given. The file is a
+// JSON list of {"level": "read", "patterns": ["regex", ...]} objects.
+func newAccessTaxonomy(taxonomyFile string) (*accessTaxonomy, error) {
+	rules := defaultAccessLevelRules
+	if taxonomyFile != "" {
+		data, err := os.ReadFile(taxonomyFile)
+		if err != nil {
+			return nil, fmt.Errorf("wiz-connector: error reading access level taxonomy file: %w", err)
+		}
+		rules = nil
+		err = json.Unmarshal(data, &rules)
+		if err != nil {
+			return nil, fmt.Errorf(`wiz-connector: error parsing access level taxonomy file, format should be [{"level":"read","patterns":["regex"]}]: %w`, err)
+		}
+	}
+
+	compiled := make([]*accessLevelRule, 0, len(rules))
+	for _, r := range rules {
+		if r.Level == "" || len(r.Patterns) == 0 {
+			return nil, fmt.Errorf("wiz-connector: access level taxonomy rules need a level and at least one pattern")
+		}
+		rule := &accessLevelRule{Level: r.Level, Patterns: r.Patterns}
+		for _, p := range r.Patterns {
+			re, err := regexp.Compile("(?i)" + p)
+			if err != nil {
+				return nil, fmt.Errorf("wiz-connector: invalid pattern %q for access level %s: %w", p, r.Level, err)
+			}
+			rule.compiled = append(rule.compiled, re)
+		}
+		compiled = append(compiled, rule)
+	}
+
+	return &accessTaxonomy{rules: compiled}, nil
+}
+
+// Levels returns the access levels the permission maps to, or the raw permission when no rule matches.
+func (t *accessTaxonomy) Levels(permission string) []string {
+	var levels []string
+	for _, r := range t.rules {
+		for _, re := range r.compiled {
+			if re.MatchString(permission) {
+				levels = append(levels, r.Level)
+				break
+			}
+		}
+	}
+	if len(levels) == 0 {
+		return []string{permission}
+	}
+	return levels
+}
+
+// Group maps each access level to the sorted raw permissions normalized into it.
+func (t *accessTaxonomy) Group(permissions []string) map[string][]string {
+	grouped := make(map[string]map[string]bool)
+	for _, p := range permissions {
+		for _, level := range t.Levels(p) {
+			if grouped[level] == nil {
+				grouped[level] = make(map[string]bool)
+			}
+			grouped[level][p] = true
+		}
+	}
+
+	rv := make(map[string][]string, len(grouped))
+	for level, raw := range grouped {
+		perms := make([]string, 0, len(raw))
+		for p := range raw {
+			perms = append(perms, p)
+		}
+		sort.Strings(perms)
+		rv[level] = perms
+	}
+	return rv
+}
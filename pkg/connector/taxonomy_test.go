@@ -0,0 +1,171 @@
+package connector
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+)
+
+func TestAccessTaxonomyLevels(t *testing.T) {
+	taxonomy, err := newAccessTaxonomy("")
+	if err != nil {
+		t.Fatalf("newAccessTaxonomy() error = %v", err)
+	}
+
+	tests := []struct {
+		permission string
+		want       []string
+	}{
+		// AWS actions.
+		{permission: "*", want: []string{AccessLevelAdmin}},
+		{permission: "s3:*", want: []string{AccessLevelAdmin}},
+		{permission: "iam:PassRole", want: []string{AccessLevelPermissionsManagement}},
+		{permission: "s3:PutBucketAcl", want: []string{AccessLevelPermissionsManagement, AccessLevelWrite}},
+		{permission: "s3:GetObject", want: []string{AccessLevelDataAccess, AccessLevelRead}},
+		{permission: "s3:DeleteObject", want: []string{AccessLevelDataAccess, AccessLevelDelete}},
+		{permission: "ec2:TerminateInstances", want: []string{AccessLevelDelete}},
+		{permission: "s3:ListBucket", want: []string{AccessLevelList}},
+		{permission: "ec2:StartInstances", want: []string{AccessLevelWrite}},
+		{permission: "ec2:DescribeInstances", want: []string{AccessLevelRead}},
+		{permission: "kms:Decrypt", want: []string{AccessLevelDataAccess}},
+		// Azure actions and role names.
+		{permission: "Microsoft.Storage/storageAccounts/*", want: []string{AccessLevelAdmin}},
+		{permission: "Microsoft.Authorization/roleAssignments/write", want: []string{AccessLevelPermissionsManagement, AccessLevelWrite}},
+		{permission: "Storage Blob Data Reader", want: []string{AccessLevelDataAccess, AccessLevelRead}},
+		{permission: "Microsoft.Storage/storageAccounts/read", want: []string{AccessLevelRead}},
+		{permission: "Contributor", want: []string{AccessLevelWrite}},
+		// GCP permissions and roles.
+		{permission: "roles/owner", want: []string{AccessLevelAdmin}},
+		{permission: "storage.buckets.setIamPolicy", want: []string{AccessLevelPermissionsManagement, AccessLevelWrite}},
+		{permission: "storage.objects.get", want: []string{AccessLevelDataAccess, AccessLevelRead}},
+		{permission: "compute.instances.list", want: []string{AccessLevelList}},
+		{permission: "roles/viewer", want: []string{AccessLevelRead}},
+		// Permissions matching no rule keep their raw name.
+		{permission: "sts:AssumeRole", want: []string{"sts:AssumeRole"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.permission, func(t *testing.T) {
+			if got := taxonomy.Levels(tt.permission); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Levels(%q) = %v, want %v", tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessTaxonomyGroup(t *testing.T) {
+	taxonomy, err := newAccessTaxonomy("")
+	if err != nil {
+		t.Fatalf("newAccessTaxonomy() error = %v", err)
+	}
+
+	got := taxonomy.Group([]string{"s3:ListBucket", "ec2:DescribeInstances", "s3:GetBucketPolicy", "sts:AssumeRole", "s3:ListBucket"})
+	want := map[string][]string{
+		AccessLevelList:  {"s3:ListBucket"},
+		AccessLevelRead:  {"ec2:DescribeInstances", "s3:GetBucketPolicy"},
+		"sts:AssumeRole": {"sts:AssumeRole"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Group() = %v, want %v", got, want)
+	}
+}
+
+func TestNewAccessTaxonomyFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid", content: `[{"level": "read", "patterns": ["^s3:get"]}]`},
+		{name: "invalid json", content: `{"level": "read"}`, wantErr: true},
+		{name: "missing level", content: `[{"patterns": ["^s3:get"]}]`, wantErr: true},
+		{name: "missing patterns", content: `[{"level": "read"}]`, wantErr: true},
+		{name: "invalid pattern", content: `[{"level": "read", "patterns": ["("]}]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "taxonomy.json")
+			err := os.WriteFile(path, []byte(tt.content), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			taxonomy, err := newAccessTaxonomy(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newAccessTaxonomy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := taxonomy.Levels("S3:GetObject"); !reflect.DeepEqual(got, []string{"read"}) {
+				t.Errorf("Levels() = %v, want [read]", got)
+			}
+		})
+	}
+}
+
+func TestPrivilegeClassifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "taxonomy.json")
+	err := os.WriteFile(path, []byte(`[{"level": "admin", "patterns": ["^s3:putobject$", "^owner \\(preview\\)$"]}]`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withMetadata := func(md *EntitlementMetadata) annotations.Annotations {
+		st, err := keyedAnnotation(EntitlementMetadataKey, md)
+		if err != nil {
+			t.Fatal(err)
+		}
+		annos := annotations.Annotations{}
+		annos.Update(st)
+		return annos
+	}
+
+	tests := []struct {
+		name         string
+		taxonomyFile string
+		ent          *v2.Entitlement
+		want         string
+	}{
+		{name: "default rules", ent: &v2.Entitlement{Slug: "s3:PutObject"}, want: PrivilegeLevelStandard},
+		{name: "taxonomy file", taxonomyFile: path, ent: &v2.Entitlement{Slug: "s3:PutObject"}, want: PrivilegeLevelAdmin},
+		{name: "permission with parentheses", taxonomyFile: path, ent: &v2.Entitlement{Slug: "Owner (preview)"}, want: PrivilegeLevelAdmin},
+		{
+			name:         "qualified slug",
+			taxonomyFile: path,
+			ent: &v2.Entitlement{
+				Slug:        "s3:PutObject (sensitive data)",
+				Annotations: withMetadata(&EntitlementMetadata{Permission: "s3:PutObject", DataSensitivity: DataSensitivitySensitive}),
+			},
+			want: PrivilegeLevelAdmin,
+		},
+		{
+			name:         "normalized",
+			taxonomyFile: path,
+			ent: &v2.Entitlement{
+				Slug:        "write",
+				Annotations: withMetadata(&EntitlementMetadata{Permission: "write", AccessLevel: "write", Permissions: []string{"s3:PutObject"}}),
+			},
+			want: PrivilegeLevelAdmin,
+		},
+		{
+			name:         "marked",
+			taxonomyFile: path,
+			ent:          &v2.Entitlement{Slug: "s3:GetObject", Annotations: withMetadata(&EntitlementMetadata{PrivilegeLevel: PrivilegeLevelHigh})},
+			want:         PrivilegeLevelHigh,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			classifier, err := NewPrivilegeClassifier(tt.taxonomyFile)
+			if err != nil {
+				t.Fatalf("NewPrivilegeClassifier() error = %v", err)
+			}
+			if got := classifier.EntitlementPrivilegeLevel(tt.ent); got != tt.want {
+				t.Errorf("EntitlementPrivilegeLevel(%q) = %q, want %q", tt.ent.GetSlug(), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package connector
+
+import (
+	"context"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/conductorone/baton-wiz/pkg/connector"
+
+var (
+	tracer = otel.Tracer(instrumentationName)
+	meter  = otel.Meter(instrumentationName)
+
+	// Instruments fall back to no-ops when they cannot be created, telemetry never fails a sync.
+	resourceCounter, _    = meter.Int64Counter("wiz.resources.listed", metric.WithDescription("Resources listed per resource type"))
+	entitlementCounter, _ = meter.Int64Counter("wiz.entitlements.emitted", metric.WithDescription("Entitlements emitted per resource type"))
+	grantCounter, _       = meter.Int64Counter("wiz.grants.emitted", metric.WithDescription("Grants emitted per resource type"))
+)
+
+// tracedSyncer wraps a ResourceSyncer with a span per page and counters of what each page emitted, so a slow sync
+// shows which resource type it spends its time on. The Wiz API calls made for the page are child spans. Pages and
+// errors are also recorded in the sync report.
+type tracedSyncer struct {
+	connectorbuilder.ResourceSyncer
+	resourceTypeID string
+	report         *syncReport
+}
+
+func newTracedSyncers(ctx context.Context, syncers []connectorbuilder.ResourceSyncer, report *syncReport) []connectorbuilder.ResourceSyncer {
+	rv := make([]connectorbuilder.ResourceSyncer, 0, len(syncers))
+	for _, s := range syncers {
+		rv = append(rv, &tracedSyncer{ResourceSyncer: s, resourceTypeID: s.ResourceType(ctx).Id, report: report})
+	}
+	return rv
+}
+
+func (t *tracedSyncer) start(ctx context.Context, call string, resource *v2.ResourceId, pToken *pagination.Token) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("baton.resource_type", t.resourceTypeID),
+		attribute.Bool("baton.first_page", pToken == nil || pToken.Token == ""),
+	}
+	if resource != nil {
+		attrs = append(attrs, attribute.String("baton.resource_id", resource.Resource))
+	}
+	return tracer.Start(ctx, "baton-wiz "+call+" "+t.resourceTypeID, trace.WithAttributes(attrs...))
+}
+
+func (t *tracedSyncer) end(ctx context.Context, span trace.Span, call string, resource *v2.ResourceId, count int, err error) {
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("baton.result_count", count))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		t.report.recordError(ctx, t.resourceTypeID, call, resource.GetResource(), err)
+		return
+	}
+
+	attrs := metric.WithAttributes(attribute.String("baton.resource_type", t.resourceTypeID))
+	switch call {
+	case "List":
+		resourceCounter.Add(ctx, int64(count), attrs)
+	case "Entitlements":
+		entitlementCounter.Add(ctx, int64(count), attrs)
+	case "Grants":
+		grantCounter.Add(ctx, int64(count), attrs)
+	}
+	t.report.recordPage(t.resourceTypeID, call, count)
+}
+
+func (t *tracedSyncer) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	ctx, span := t.start(ctx, "List", parentResourceID, pToken)
+	rv, nextPageToken, annos, err := t.ResourceSyncer.List(ctx, parentResourceID, pToken)
+	t.end(ctx, span, "List", parentResourceID, len(rv), err)
+	return rv, nextPageToken, annos, err
+}
+
+func (t *tracedSyncer) Entitlements(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	ctx, span := t.start(ctx, "Entitlements", resource.GetId(), pToken)
+	rv, nextPageToken, annos, err := t.ResourceSyncer.Entitlements(ctx, resource, pToken)
+	t.end(ctx, span, "Entitlements", resource.GetId(), len(rv), err)
+	return rv, nextPageToken, annos, err
+}
+
+func (t *tracedSyncer) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	ctx, span := t.start(ctx, "Grants", resource.GetId(), pToken)
+	rv, nextPageToken, annos, err := t.ResourceSyncer.Grants(ctx, resource, pToken)
+	t.end(ctx, span, "Grants", resource.GetId(), len(rv), err)
+	return rv, nextPageToken, annos, err
+}
@@ -0,0 +1,301 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	sdkEntitlement "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	sdkGrant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-wiz/pkg/client"
+	"google.golang.org/protobuf/proto"
+)
+
+// tenantSeparator joins a tenant name and the ID of a resource or principal in that tenant. Tenant names cannot
+// contain it.
+const tenantSeparator = "/"
+
+// tenant is one Wiz tenant synced by the connector, with its own client and sync state. The tenant configured with
+// flags alone is unnamed, and its IDs are not namespaced.
+type tenant struct {
+	name         string
+	config       *Config
+	client       *client.Client
+	identity     *identityResolver
+	typeMappings *resourceTypeMappings
+	taxonomy     *accessTaxonomy
+	classifier   *accessTaxonomy
+	// profileScopes are the sync profile scopes synced from the tenant, none without a sync profile.
+	profileScopes []*ProfileScope
+}
+
+// resourceSyncers returns a ResourceSyncer for each resource type synced from the tenant.
+func (t *tenant) resourceSyncers() []connectorbuilder.ResourceSyncer {
+	resourceSyncers := []connectorbuilder.ResourceSyncer{
+		newResourceBuilder(t.client, t.config, t.identity, t.typeMappings, t.taxonomy, t.classifier),
+	}
+	if !t.config.ExternalSyncMode {
+		resourceSyncers = append(resourceSyncers, newUserBuilder(t.client, t.identity))
+	}
+	if t.config.SyncRoles {
+		resourceSyncers = append(resourceSyncers, newRoleBuilder(t.client, t.identity.unscoped(), t.config.ExternalSyncMode))
+	}
+	if t.config.SyncIssues {
+		resourceSyncers = append(resourceSyncers, newIssueBuilder(t.client, t.identity, t.config.ExternalSyncMode))
+	}
+	return resourceSyncers
+}
+
+func (t *tenant) namespace(id string) string {
+	return t.name + tenantSeparator + id
+}
+
+// syncID returns the ID the sync gives a resource or principal of the tenant, only namespaced when the tenant is named.
+func (t *tenant) syncID(id string) string {
+	if t.name == "" {
+		return id
+	}
+	return t.namespace(id)
+}
+
+func (t *tenant) namespaceResourceID(id *v2.ResourceId) *v2.ResourceId {
+	return &v2.ResourceId{ResourceType: id.ResourceType, Resource: t.namespace(id.Resource)}
+}
+
+// namespaceEntitlementID returns the ID of an entitlement of the resource once the resource is namespaced, given its
+// ID within the tenant. The slug is what follows the resource's own prefix, as resource IDs can contain ':'.
+func (t *tenant) namespaceEntitlementID(resourceID *v2.ResourceId, id string) (string, error) {
+	slug, ok := strings.CutPrefix(id, sdkEntitlement.NewEntitlementID(&v2.Resource{Id: resourceID}, ""))
+	if !ok {
+		return "", fmt.Errorf("wiz-connector: entitlement %q does not belong to %s %q", id, resourceID.ResourceType, resourceID.Resource)
+	}
+	return sdkEntitlement.NewEntitlementID(&v2.Resource{Id: t.namespaceResourceID(resourceID)}, slug), nil
+}
+
+// splitTenantID returns the tenant name and the Wiz ID of a namespaced ID.
+func splitTenantID(id string) (string, string, error) {
+	name, raw, ok := strings.Cut(id, tenantSeparator)
+	if !ok {
+		return "", "", fmt.Errorf("wiz-connector: %q is not namespaced by tenant", id)
+	}
+	return name, raw, nil
+}
+
+// tenantSyncer syncs one resource type across every tenant. Each tenant has its own ResourceSyncer, and IDs are
+// namespaced by tenant on the way out and stripped on the way in, so the per-tenant syncers are unaware of tenancy.
+// Resources at the top of a tenant are children of its tenant resource.
+type tenantSyncer struct {
+	resourceType *v2.ResourceType
+	tenants      map[string]*tenant
+	syncers      map[string]connectorbuilder.ResourceSyncer
+}
+
+func (o *tenantSyncer) ResourceType(ctx context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+func (o *tenantSyncer) tenantSyncer(name string) (*tenant, connectorbuilder.ResourceSyncer, error) {
+	t, ok := o.tenants[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("wiz-connector: unknown tenant %q", name)
+	}
+	return t, o.syncers[name], nil
+}
+
+func (o *tenantSyncer) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentResourceID == nil {
+		return nil, "", nil, nil
+	}
+
+	var tenantName string
+	var innerParent *v2.ResourceId
+	if parentResourceID.ResourceType == tenantResourceType.Id {
+		tenantName = parentResourceID.Resource
+	} else {
+		var raw string
+		var err error
+		tenantName, raw, err = splitTenantID(parentResourceID.Resource)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		innerParent = &v2.ResourceId{ResourceType: parentResourceID.ResourceType, Resource: raw}
+	}
+
+	t, syncer, err := o.tenantSyncer(tenantName)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	resources, nextPageToken, annos, err := syncer.List(ctx, innerParent, pToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	for _, r := range resources {
+		r.Id = t.namespaceResourceID(r.Id)
+		if r.ParentResourceId == nil {
+			r.ParentResourceId = parentResourceID
+		} else {
+			r.ParentResourceId = t.namespaceResourceID(r.ParentResourceId)
+		}
+	}
+	return resources, nextPageToken, annos, nil
+}
+
+// unwrap returns the tenant of the namespaced resource and the resource as its tenant's syncer listed it.
+func (o *tenantSyncer) unwrap(resource *v2.Resource) (*tenant, connectorbuilder.ResourceSyncer, *v2.Resource, error) {
+	tenantName, raw, err := splitTenantID(resource.Id.Resource)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	t, syncer, err := o.tenantSyncer(tenantName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	inner := proto.Clone(resource).(*v2.Resource)
+	inner.Id = &v2.ResourceId{ResourceType: resource.Id.ResourceType, Resource: raw}
+	inner.ParentResourceId = nil
+	if parent := resource.ParentResourceId; parent != nil && parent.ResourceType != tenantResourceType.Id {
+		_, parentRaw, err := splitTenantID(parent.Resource)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		inner.ParentResourceId = &v2.ResourceId{ResourceType: parent.ResourceType, Resource: parentRaw}
+	}
+	return t, syncer, inner, nil
+}
+
+func (o *tenantSyncer) Entitlements(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	t, syncer, inner, err := o.unwrap(resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	entitlements, nextPageToken, annos, err := syncer.Entitlements(ctx, inner, pToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	for _, e := range entitlements {
+		e.Id, err = t.namespaceEntitlementID(inner.Id, e.Id)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		e.Resource = resource
+	}
+	return entitlements, nextPageToken, annos, nil
+}
+
+func (o *tenantSyncer) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	t, syncer, inner, err := o.unwrap(resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	grants, nextPageToken, annos, err := syncer.Grants(ctx, inner, pToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	for _, g := range grants {
+		g.Entitlement.Id, err = t.namespaceEntitlementID(inner.Id, g.Entitlement.Id)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		g.Entitlement.Resource = resource
+		principalID := g.Principal.Id
+		g.Principal.Id = t.namespaceResourceID(principalID)
+		g.Id = sdkGrant.NewGrantID(g.Principal, g.Entitlement)
+
+		// Grants expand the entitlements of their principal, such as the assignment of a role.
+		grantAnnos := annotations.Annotations(g.Annotations)
+		expandable := &v2.GrantExpandable{}
+		ok, err := grantAnnos.Pick(expandable)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if ok {
+			for i, id := range expandable.EntitlementIds {
+				expandable.EntitlementIds[i], err = t.namespaceEntitlementID(principalID, id)
+				if err != nil {
+					return nil, "", nil, err
+				}
+			}
+			grantAnnos.Update(expandable)
+			g.Annotations = grantAnnos
+		}
+	}
+	return grants, nextPageToken, annos, nil
+}
+
+// tenantBuilder lists a resource per tenant, parent of everything synced from that tenant.
+type tenantBuilder struct {
+	tenants []*tenant
+	// childResourceTypes are the resource types at the top of each tenant.
+	childResourceTypes []string
+}
+
+func (o *tenantBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return tenantResourceType
+}
+
+func (o *tenantBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentResourceID != nil {
+		return nil, "", nil, nil
+	}
+
+	var rv []*v2.Resource
+	for _, t := range o.tenants {
+		opts := []rs.ResourceOption{rs.WithDescription(fmt.Sprintf("Wiz tenant at %s", t.config.EndpointURL))}
+		for _, rt := range o.childResourceTypes {
+			opts = append(opts, rs.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: rt}))
+		}
+		resource, err := rs.NewResource(t.name, tenantResourceType, t.name, opts...)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		rv = append(rv, resource)
+	}
+	return rv, "", nil, nil
+}
+
+func (o *tenantBuilder) Entitlements(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func (o *tenantBuilder) Grants(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// newTenantSyncers returns the tenant builder and a tenantSyncer for each resource type synced from the tenants.
+func newTenantSyncers(ctx context.Context, tenants []*tenant) []connectorbuilder.ResourceSyncer {
+	byName := make(map[string]*tenant, len(tenants))
+	var syncers []*tenantSyncer
+	for _, t := range tenants {
+		byName[t.name] = t
+		for i, s := range t.resourceSyncers() {
+			if i == len(syncers) {
+				syncers = append(syncers, &tenantSyncer{
+					resourceType: s.ResourceType(ctx),
+					tenants:      byName,
+					syncers:      make(map[string]connectorbuilder.ResourceSyncer),
+				})
+			}
+			syncers[i].syncers[t.name] = s
+		}
+	}
+
+	tb := &tenantBuilder{tenants: tenants}
+	rv := []connectorbuilder.ResourceSyncer{tb}
+	for _, s := range syncers {
+		// Issues are children of the resources they affect, everything else is at the top of the tenant.
+		if s.resourceType.Id != issueResourceType.Id {
+			tb.childResourceTypes = append(tb.childResourceTypes, s.resourceType.Id)
+		}
+		rv = append(rv, s)
+	}
+	return rv
+}
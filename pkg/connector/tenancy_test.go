@@ -0,0 +1,69 @@
+package connector
+
+import (
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+)
+
+func TestNamespaceEntitlementID(t *testing.T) {
+	tn := &tenant{name: "us"}
+	resource := &v2.ResourceId{ResourceType: "wiz_resource", Resource: "r1"}
+	role := &v2.ResourceId{ResourceType: "role", Resource: "arn:aws:iam::123456789012:role/admin"}
+	tests := []struct {
+		name       string
+		resourceID *v2.ResourceId
+		id         string
+		want       string
+		wantErr    bool
+	}{
+		{name: "resource", resourceID: resource, id: "wiz_resource:r1:read", want: "wiz_resource:us/r1:read"},
+		{name: "slug with separators", resourceID: resource, id: "wiz_resource:r1:s3:GetObject", want: "wiz_resource:us/r1:s3:GetObject"},
+		{name: "resource id with separators", resourceID: role, id: "role:arn:aws:iam::123456789012:role/admin:assigned", want: "role:us/arn:aws:iam::123456789012:role/admin:assigned"},
+		{name: "another resource", resourceID: resource, id: "wiz_resource:r2:read", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tn.namespaceEntitlementID(tt.resourceID, tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("namespaceEntitlementID(%q) error = %v, wantErr %v", tt.id, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("namespaceEntitlementID(%q) = %q, want %q", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitTenantID(t *testing.T) {
+	tests := []struct {
+		id       string
+		wantName string
+		wantRaw  string
+		wantErr  bool
+	}{
+		{id: "us/r1", wantName: "us", wantRaw: "r1"},
+		{id: "us/arn:aws:iam::123456789012:role/admin", wantName: "us", wantRaw: "arn:aws:iam::123456789012:role/admin"},
+		{id: "r1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			name, raw, err := splitTenantID(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitTenantID(%q) error = %v, wantErr %v", tt.id, err, tt.wantErr)
+			}
+			if name != tt.wantName || raw != tt.wantRaw {
+				t.Errorf("splitTenantID(%q) = %q, %q, want %q, %q", tt.id, name, raw, tt.wantName, tt.wantRaw)
+			}
+		})
+	}
+}
+
+func TestTenantSyncID(t *testing.T) {
+	if got := (&tenant{}).syncID("u1"); got != "u1" {
+		t.Errorf("syncID() of the unnamed tenant = %q, want u1", got)
+	}
+	if got := (&tenant{name: "eu"}).syncID("u1"); got != "eu/u1" {
+		t.Errorf("syncID() = %q, want eu/u1", got)
+	}
+}
@@ -11,7 +11,8 @@ import (
 )
 
 type userBuilder struct {
-	client *client.Client
+	client   *client.Client
+	identity *identityResolver
 }
 
 func (o *userBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
@@ -20,6 +21,9 @@ func (o *userBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 
 // List returns all the users from the database as resource objects.
 // Users include a UserTrait because they are the 'shape' of a standard user.
+// With identity correlation, each principal is emitted as the user its correlated accounts resolve to, once per
+// page. Principals with access to several resources appear on several pages, and every copy of a user is the same.
+// Principals are resolved with the identity settings of the scope that listed the resource they have access to.
 func (o *userBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
 	var rv []*v2.Resource
 	usersWithAccess, nextPageToken, err := o.client.ListUsersWithAccessToResources(ctx, pToken)
@@ -27,64 +31,120 @@ func (o *userBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId,
 		return nil, "", nil, err
 	}
 
+	identity := o.identity.forScope(usersWithAccess.Scope)
+	seen := make(map[string]bool)
 	for _, n := range usersWithAccess.Data.EntityEffectiveAccessEntries.Nodes {
 		user := n.GrantedEntity
-		primaryEmail := user.Properties.PrimaryEmail
-		if primaryEmail == "" {
-			primaryEmail = user.Properties.Email
+		userId, err := identity.Resolve(ctx, user)
+		if err != nil {
+			return nil, "", nil, err
 		}
-
-		firstName, lastName := rs.SplitFullName(user.Name)
-		profile := map[string]interface{}{
-			"login":      primaryEmail,
-			"user_id":    user.Id,
-			"first_name": firstName,
-			"last_name":  lastName,
+		if seen[userId] {
+			continue
 		}
+		seen[userId] = true
 
-		userTraitOptions := []rs.UserTraitOption{
-			rs.WithEmail(primaryEmail, true),
-			rs.WithUserLogin(primaryEmail),
-			rs.WithUserProfile(profile),
+		var linked []*client.GrantedEntity
+		if identity.correlator != nil {
+			linked, err = identity.LinkedAccounts(ctx, user)
+			if err != nil {
+				return nil, "", nil, err
+			}
+			user = primaryAccount(linked)
 		}
+		resource, err := userResource(userId, user, linked)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		rv = append(rv, resource)
+	}
+
+	if nextPageToken == "" {
+		logExclusions(ctx, o.client)
+	}
+
+	return rv, nextPageToken, nil, nil
+}
+
+// userResource builds the user resource for the Wiz principal. Linked accounts are the principal's correlated
+// sub-accounts across clouds and are only set when identity correlation is enabled.
+func userResource(userId string, user *client.GrantedEntity, linked []*client.GrantedEntity) (*v2.Resource, error) {
+	userEmail := primaryEmail(user)
+
+	firstName, lastName := rs.SplitFullName(user.Name)
+	profile := map[string]interface{}{
+		"login":      userEmail,
+		"user_id":    user.Id,
+		"first_name": firstName,
+		"last_name":  lastName,
+	}
 
-		if user.Properties.Enabled != nil {
-			if *user.Properties.Enabled {
-				userTraitOptions = append(userTraitOptions, rs.WithStatus(v2.UserTrait_Status_STATUS_ENABLED))
-			} else {
-				userTraitOptions = append(userTraitOptions, rs.WithStatus(v2.UserTrait_Status_STATUS_DISABLED))
+	if len(linked) != 0 {
+		linkedAccounts := make([]interface{}, 0, len(linked))
+		var cloudPlatforms []interface{}
+		seenPlatforms := make(map[string]bool)
+		for _, account := range linked {
+			linkedAccounts = append(linkedAccounts, linkedAccountProfile(account))
+			platform := account.Properties.CloudPlatform
+			if platform != "" && !seenPlatforms[platform] {
+				seenPlatforms[platform] = true
+				cloudPlatforms = append(cloudPlatforms, platform)
 			}
 		}
+		profile["linked_accounts"] = linkedAccounts
+		profile["cloud_platforms"] = cloudPlatforms
+	}
+
+	userTraitOptions := []rs.UserTraitOption{
+		rs.WithEmail(userEmail, true),
+		rs.WithUserLogin(userEmail),
+		rs.WithUserProfile(profile),
+	}
 
-		if user.Type == client.GrantedEntityTypeServiceAccount {
-			userTraitOptions = append(userTraitOptions, rs.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_SERVICE))
+	if user.Properties.Enabled != nil {
+		if *user.Properties.Enabled {
+			userTraitOptions = append(userTraitOptions, rs.WithStatus(v2.UserTrait_Status_STATUS_ENABLED))
+		} else {
+			userTraitOptions = append(userTraitOptions, rs.WithStatus(v2.UserTrait_Status_STATUS_DISABLED))
 		}
+	}
 
-		for _, email := range user.Properties.Emails {
-			if email != primaryEmail {
+	if user.Type == client.GrantedEntityTypeServiceAccount {
+		userTraitOptions = append(userTraitOptions, rs.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_SERVICE))
+	}
+
+	seenEmails := map[string]bool{userEmail: true}
+	accounts := linked
+	if len(accounts) == 0 {
+		accounts = []*client.GrantedEntity{user}
+	}
+	for _, account := range accounts {
+		emails := append([]string{primaryEmail(account)}, account.Properties.Emails...)
+		for _, email := range emails {
+			if email != "" && !seenEmails[email] {
+				seenEmails[email] = true
 				userTraitOptions = append(userTraitOptions, rs.WithEmail(email, false))
 			}
 		}
+	}
 
-		userId := primaryEmail
-		if userId == "" {
-			userId = user.Id
-		}
+	return rs.NewUserResource(
+		user.Name,
+		userResourceType,
+		userId,
+		userTraitOptions,
+	)
+}
 
-		resource, err := rs.NewUserResource(
-			user.Name,
-			userResourceType,
-			userId,
-			userTraitOptions,
-		)
-		if err != nil {
-			return nil, "", nil, err
+// primaryAccount picks the account whose name and email represent a correlated user: the first one with an email.
+func primaryAccount(accounts []*client.GrantedEntity) *client.GrantedEntity {
+	for _, account := range accounts {
+		if primaryEmail(account) != "" {
+			return account
 		}
-
-		rv = append(rv, resource)
 	}
-
-	return rv, nextPageToken, nil, nil
+	return accounts[0]
 }
 
 // Entitlements always returns an empty slice for users.
@@ -97,6 +157,6 @@ func (o *userBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken
 	return nil, "", nil, nil
 }
 
-func newUserBuilder(client *client.Client) *userBuilder {
-	return &userBuilder{client: client}
+func newUserBuilder(client *client.Client, identity *identityResolver) *userBuilder {
+	return &userBuilder{client: client, identity: identity}
 }
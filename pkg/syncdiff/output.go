@@ -0,0 +1,153 @@
+package syncdiff
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/conductorone/baton-wiz/pkg/connector"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// Write writes the diff in the format: text, json or csv.
+func (d *Diff) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatText, "":
+		return d.writeText(w)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	case FormatCSV:
+		return d.writeCSV(w)
+	default:
+		return fmt.Errorf("wiz-connector: invalid output format %q, must be %s, %s or %s", format, FormatText, FormatJSON, FormatCSV)
+	}
+}
+
+func (d *Diff) writeText(w io.Writer) error {
+	p := &textPrinter{w: w}
+
+	p.printf("%d resources added, %d removed\n", len(d.AddedResources), len(d.RemovedResources))
+	p.printf("%d principals added, %d removed\n", len(d.AddedPrincipals), len(d.RemovedPrincipals))
+	p.printf("%d grants added, %d removed\n", len(d.AddedGrants), len(d.RemovedGrants))
+
+	if len(d.NewAdminGrants) != 0 {
+		p.printf("\n!! %d new admin grants\n", len(d.NewAdminGrants))
+		for _, g := range d.NewAdminGrants {
+			p.printf("  + %s has %s on %s (%s)\n", g.PrincipalName, g.Entitlement, g.ResourceName, g.ResourceID)
+		}
+	}
+	if len(d.NewExternalPrincipals) != 0 {
+		p.printf("\n!! %d new external principals\n", len(d.NewExternalPrincipals))
+		for _, r := range d.NewExternalPrincipals {
+			p.printf("  + %s <%s> (%s)\n", r.Name, r.Email, r.ID)
+		}
+	}
+
+	p.resources("Added resources", "+", d.AddedResources)
+	p.resources("Removed resources", "-", d.RemovedResources)
+	p.resources("Added principals", "+", d.AddedPrincipals)
+	p.resources("Removed principals", "-", d.RemovedPrincipals)
+	p.grants("Added grants", "+", d.AddedGrants)
+	p.grants("Removed grants", "-", d.RemovedGrants)
+
+	return p.err
+}
+
+// textPrinter keeps the first write error, so the text output reads as a list of lines.
+type textPrinter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *textPrinter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+func (p *textPrinter) resources(title string, sign string, rs []*Resource) {
+	if len(rs) == 0 {
+		return
+	}
+	p.printf("\n%s:\n", title)
+	for _, r := range rs {
+		p.printf("  %s %s %s (%s)\n", sign, r.Type, r.Name, r.ID)
+	}
+}
+
+func (p *textPrinter) grants(title string, sign string, gs []*Grant) {
+	if len(gs) == 0 {
+		return
+	}
+	p.printf("\n%s:\n", title)
+	for _, g := range gs {
+		p.printf("  %s %s %s: %s on %s %s\n", sign, g.PrincipalType, g.PrincipalName, g.Entitlement, g.ResourceType, g.ResourceName)
+	}
+}
+
+// writeCSV writes one row per change, so the file can be filtered by change and kind in a spreadsheet.
+func (d *Diff) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	rows := [][]string{{
+		"change", "kind", "highlight",
+		"resource_type", "resource_id", "resource_name",
+		"entitlement", "privilege_level",
+		"principal_type", "principal_id", "principal_name", "principal_email",
+	}}
+
+	external := make(map[string]bool, len(d.NewExternalPrincipals))
+	for _, r := range d.NewExternalPrincipals {
+		external[r.key()] = true
+	}
+
+	resourceRows := func(change string, rs []*Resource) {
+		for _, r := range rs {
+			rows = append(rows, []string{change, "resource", "", r.Type, r.ID, r.Name, "", "", "", "", "", ""})
+		}
+	}
+	principalRows := func(change string, rs []*Resource) {
+		for _, r := range rs {
+			highlight := ""
+			if change == "added" && external[r.key()] {
+				highlight = "external"
+			}
+			rows = append(rows, []string{change, "principal", highlight, "", "", "", "", "", r.Type, r.ID, r.Name, r.Email})
+		}
+	}
+	grantRows := func(change string, gs []*Grant) {
+		for _, g := range gs {
+			highlight := ""
+			if change == "added" && g.PrivilegeLevel == connector.PrivilegeLevelAdmin {
+				highlight = "admin"
+			}
+			rows = append(rows, []string{
+				change, "grant", highlight,
+				g.ResourceType, g.ResourceID, g.ResourceName,
+				g.Entitlement, g.PrivilegeLevel,
+				g.PrincipalType, g.PrincipalID, g.PrincipalName, "",
+			})
+		}
+	}
+
+	resourceRows("added", d.AddedResources)
+	resourceRows("removed", d.RemovedResources)
+	principalRows("added", d.AddedPrincipals)
+	principalRows("removed", d.RemovedPrincipals)
+	grantRows("added", d.AddedGrants)
+	grantRows("removed", d.RemovedGrants)
+
+	err := cw.WriteAll(rows)
+	if err != nil {
+		return fmt.Errorf("wiz-connector: error writing csv: %w", err)
+	}
+	return nil
+}
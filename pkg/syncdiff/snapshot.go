@@ -0,0 +1,162 @@
+package syncdiff
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/dotc1z"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-wiz/pkg/connector"
+)
+
+// Resource is a resource or principal of a sync.
+type Resource struct {
+	Type  string `json:"type"`
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+func (r *Resource) key() string {
+	return r.Type + ":" + r.ID
+}
+
+// Grant is a permission a principal holds on a resource.
+type Grant struct {
+	ID             string `json:"id"`
+	ResourceType   string `json:"resource_type"`
+	ResourceID     string `json:"resource_id"`
+	ResourceName   string `json:"resource_name"`
+	Entitlement    string `json:"entitlement"`
+	PrincipalType  string `json:"principal_type"`
+	PrincipalID    string `json:"principal_id"`
+	PrincipalName  string `json:"principal_name"`
+	PrivilegeLevel string `json:"privilege_level"`
+}
+
+// Snapshot is what a sync produced by this connector holds.
+type Snapshot struct {
+	Resources map[string]*Resource
+	Grants    map[string]*Grant
+	// principalTypes are the resource types that hold grants.
+	principalTypes map[string]bool
+}
+
+func (s *Snapshot) isPrincipal(r *Resource) bool {
+	return s.principalTypes[r.Type]
+}
+
+// Load reads the latest finished sync of a c1z file. Grants are classified by the privilege level of their
+// entitlement.
+func Load(ctx context.Context, path string, classifier *connector.PrivilegeClassifier) (*Snapshot, error) {
+	// dotc1z creates missing files, a typo in the path would otherwise compare against an empty sync.
+	_, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("wiz-connector: error opening %s: %w", path, err)
+	}
+
+	f, err := dotc1z.NewC1ZFile(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("wiz-connector: error opening %s: %w", path, err)
+	}
+	defer f.Close()
+
+	s := &Snapshot{
+		Resources:      make(map[string]*Resource),
+		Grants:         make(map[string]*Grant),
+		principalTypes: make(map[string]bool),
+	}
+
+	pageToken := ""
+	for {
+		resp, err := f.ListResources(ctx, &v2.ResourcesServiceListResourcesRequest{PageToken: pageToken})
+		if err != nil {
+			return nil, fmt.Errorf("wiz-connector: error listing resources of %s: %w", path, err)
+		}
+		for _, r := range resp.GetList() {
+			res := &Resource{Type: r.GetId().GetResourceType(), ID: r.GetId().GetResource(), Name: r.GetDisplayName()}
+			if trait, err := rs.GetUserTrait(r); err == nil && len(trait.GetEmails()) != 0 {
+				res.Email = trait.GetEmails()[0].GetAddress()
+			}
+			s.Resources[res.key()] = res
+		}
+		pageToken = resp.GetNextPageToken()
+		if pageToken == "" {
+			break
+		}
+	}
+
+	privilegeLevels := make(map[string]string)
+	for {
+		resp, err := f.ListEntitlements(ctx, &v2.EntitlementsServiceListEntitlementsRequest{PageToken: pageToken})
+		if err != nil {
+			return nil, fmt.Errorf("wiz-connector: error listing entitlements of %s: %w", path, err)
+		}
+		for _, e := range resp.GetList() {
+			privilegeLevels[e.GetId()] = classifier.EntitlementPrivilegeLevel(e)
+		}
+		pageToken = resp.GetNextPageToken()
+		if pageToken == "" {
+			break
+		}
+	}
+
+	for {
+		resp, err := f.ListGrants(ctx, &v2.GrantsServiceListGrantsRequest{PageToken: pageToken})
+		if err != nil {
+			return nil, fmt.Errorf("wiz-connector: error listing grants of %s: %w", path, err)
+		}
+		for _, g := range resp.GetList() {
+			s.addGrant(g, privilegeLevels, classifier)
+		}
+		pageToken = resp.GetNextPageToken()
+		if pageToken == "" {
+			break
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Snapshot) addGrant(g *v2.Grant, privilegeLevels map[string]string, classifier *connector.PrivilegeClassifier) {
+	ent := g.GetEntitlement()
+	resourceID := ent.GetResource().GetId()
+	principalID := g.GetPrincipal().GetId()
+
+	grant := &Grant{
+		ID:             g.GetId(),
+		ResourceType:   resourceID.GetResourceType(),
+		ResourceID:     resourceID.GetResource(),
+		ResourceName:   s.name(resourceID),
+		Entitlement:    entitlementSlug(ent),
+		PrincipalType:  principalID.GetResourceType(),
+		PrincipalID:    principalID.GetResource(),
+		PrincipalName:  s.name(principalID),
+		PrivilegeLevel: privilegeLevels[ent.GetId()],
+	}
+	if grant.PrivilegeLevel == "" {
+		grant.PrivilegeLevel = classifier.EntitlementPrivilegeLevel(ent)
+	}
+	s.Grants[grant.ID] = grant
+	s.principalTypes[grant.PrincipalType] = true
+}
+
+func (s *Snapshot) name(id *v2.ResourceId) string {
+	if r, ok := s.Resources[id.GetResourceType()+":"+id.GetResource()]; ok {
+		return r.Name
+	}
+	return id.GetResource()
+}
+
+// entitlementSlug returns the slug of the entitlement, or the part of its ID after the resource when it is not set
+// on the grant. Resource IDs and slugs can both contain colons, e.g. ARNs and "s3:GetObject".
+func entitlementSlug(ent *v2.Entitlement) string {
+	if ent.GetSlug() != "" {
+		return ent.GetSlug()
+	}
+	rid := ent.GetResource().GetId()
+	return strings.TrimPrefix(ent.GetId(), rid.GetResourceType()+":"+rid.GetResource()+":")
+}
@@ -0,0 +1,131 @@
+// Package syncdiff compares two syncs produced by baton-wiz and reports how access drifted between them.
+package syncdiff
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/conductorone/baton-wiz/pkg/connector"
+)
+
+// Options tune what the diff highlights.
+type Options struct {
+	// InternalDomains are the email domains of the organization. Principals with an email in another domain are
+	// external. Without internal domains, no principal is considered external.
+	InternalDomains []string
+}
+
+// Diff is what changed between an old and a new sync.
+type Diff struct {
+	AddedResources    []*Resource `json:"added_resources"`
+	RemovedResources  []*Resource `json:"removed_resources"`
+	AddedPrincipals   []*Resource `json:"added_principals"`
+	RemovedPrincipals []*Resource `json:"removed_principals"`
+	AddedGrants       []*Grant    `json:"added_grants"`
+	RemovedGrants     []*Grant    `json:"removed_grants"`
+	// NewAdminGrants are the added grants of admin privilege.
+	NewAdminGrants []*Grant `json:"new_admin_grants"`
+	// NewExternalPrincipals are the added principals with an email outside the internal domains.
+	NewExternalPrincipals []*Resource `json:"new_external_principals"`
+}
+
+// Compare returns the changes from the old snapshot to the new one.
+func Compare(old *Snapshot, current *Snapshot, opts Options) *Diff {
+	d := &Diff{
+		AddedResources:        []*Resource{},
+		RemovedResources:      []*Resource{},
+		AddedPrincipals:       []*Resource{},
+		RemovedPrincipals:     []*Resource{},
+		AddedGrants:           []*Grant{},
+		RemovedGrants:         []*Grant{},
+		NewAdminGrants:        []*Grant{},
+		NewExternalPrincipals: []*Resource{},
+	}
+
+	for key, r := range current.Resources {
+		if _, ok := old.Resources[key]; ok {
+			continue
+		}
+		if !current.isPrincipal(r) {
+			d.AddedResources = append(d.AddedResources, r)
+			continue
+		}
+		d.AddedPrincipals = append(d.AddedPrincipals, r)
+		if isExternal(r, opts.InternalDomains) {
+			d.NewExternalPrincipals = append(d.NewExternalPrincipals, r)
+		}
+	}
+	for key, r := range old.Resources {
+		if _, ok := current.Resources[key]; ok {
+			continue
+		}
+		if old.isPrincipal(r) {
+			d.RemovedPrincipals = append(d.RemovedPrincipals, r)
+		} else {
+			d.RemovedResources = append(d.RemovedResources, r)
+		}
+	}
+
+	for id, g := range current.Grants {
+		if _, ok := old.Grants[id]; ok {
+			continue
+		}
+		d.AddedGrants = append(d.AddedGrants, g)
+		if g.PrivilegeLevel == connector.PrivilegeLevelAdmin {
+			d.NewAdminGrants = append(d.NewAdminGrants, g)
+		}
+	}
+	for id, g := range old.Grants {
+		if _, ok := current.Grants[id]; !ok {
+			d.RemovedGrants = append(d.RemovedGrants, g)
+		}
+	}
+
+	for _, rs := range [][]*Resource{d.AddedResources, d.RemovedResources, d.AddedPrincipals, d.RemovedPrincipals, d.NewExternalPrincipals} {
+		slices.SortFunc(rs, compareResources)
+	}
+	for _, gs := range [][]*Grant{d.AddedGrants, d.RemovedGrants, d.NewAdminGrants} {
+		slices.SortFunc(gs, compareGrants)
+	}
+
+	return d
+}
+
+// Empty reports whether nothing changed.
+func (d *Diff) Empty() bool {
+	return len(d.AddedResources) == 0 && len(d.RemovedResources) == 0 &&
+		len(d.AddedPrincipals) == 0 && len(d.RemovedPrincipals) == 0 &&
+		len(d.AddedGrants) == 0 && len(d.RemovedGrants) == 0
+}
+
+func isExternal(r *Resource, internalDomains []string) bool {
+	if len(internalDomains) == 0 || r.Email == "" {
+		return false
+	}
+	_, domain, ok := strings.Cut(strings.ToLower(r.Email), "@")
+	if !ok {
+		return false
+	}
+	for _, internal := range internalDomains {
+		internal = strings.ToLower(strings.TrimPrefix(internal, "@"))
+		if domain == internal || strings.HasSuffix(domain, "."+internal) {
+			return false
+		}
+	}
+	return true
+}
+
+func compareResources(a *Resource, b *Resource) int {
+	return cmp.Or(cmp.Compare(a.Type, b.Type), cmp.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+}
+
+func compareGrants(a *Grant, b *Grant) int {
+	return cmp.Or(
+		cmp.Compare(a.ResourceName, b.ResourceName),
+		cmp.Compare(a.ResourceID, b.ResourceID),
+		cmp.Compare(a.Entitlement, b.Entitlement),
+		cmp.Compare(a.PrincipalName, b.PrincipalName),
+		cmp.Compare(a.ID, b.ID),
+	)
+}
@@ -0,0 +1,129 @@
+package syncdiff
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/conductorone/baton-wiz/pkg/connector"
+)
+
+func snapshot(resources []*Resource, grants []*Grant) *Snapshot {
+	s := &Snapshot{
+		Resources:      make(map[string]*Resource),
+		Grants:         make(map[string]*Grant),
+		principalTypes: map[string]bool{"user": true},
+	}
+	for _, r := range resources {
+		s.Resources[r.key()] = r
+	}
+	for _, g := range grants {
+		s.Grants[g.ID] = g
+	}
+	return s
+}
+
+func resourceIDs(rs []*Resource) []string {
+	ids := make([]string, 0, len(rs))
+	for _, r := range rs {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func grantIDs(gs []*Grant) []string {
+	ids := make([]string, 0, len(gs))
+	for _, g := range gs {
+		ids = append(ids, g.ID)
+	}
+	return ids
+}
+
+func TestCompare(t *testing.T) {
+	bucket := &Resource{Type: "wiz_resource", ID: "r1", Name: "bucket"}
+	database := &Resource{Type: "wiz_resource", ID: "r2", Name: "database"}
+	alice := &Resource{Type: "user", ID: "u1", Name: "alice", Email: "alice@example.com"}
+	bob := &Resource{Type: "user", ID: "u2", Name: "bob", Email: "bob@partner.io"}
+	carol := &Resource{Type: "user", ID: "u3", Name: "carol", Email: "carol@eu.example.com"}
+
+	aliceRead := &Grant{ID: "g1", ResourceName: "bucket", Entitlement: "read", PrincipalName: "alice", PrivilegeLevel: connector.PrivilegeLevelStandard}
+	aliceAdmin := &Grant{ID: "g2", ResourceName: "bucket", Entitlement: "admin", PrincipalName: "alice", PrivilegeLevel: connector.PrivilegeLevelAdmin}
+	bobAdmin := &Grant{ID: "g3", ResourceName: "database", Entitlement: "admin", PrincipalName: "bob", PrivilegeLevel: connector.PrivilegeLevelAdmin}
+	carolRead := &Grant{ID: "g4", ResourceName: "database", Entitlement: "read", PrincipalName: "carol", PrivilegeLevel: connector.PrivilegeLevelStandard}
+
+	tests := []struct {
+		name                      string
+		old                       *Snapshot
+		current                   *Snapshot
+		opts                      Options
+		wantAddedResources        []string
+		wantRemovedResources      []string
+		wantAddedPrincipals       []string
+		wantRemovedPrincipals     []string
+		wantAddedGrants           []string
+		wantRemovedGrants         []string
+		wantNewAdminGrants        []string
+		wantNewExternalPrincipals []string
+	}{
+		{
+			name:    "unchanged",
+			old:     snapshot([]*Resource{bucket, alice}, []*Grant{aliceRead}),
+			current: snapshot([]*Resource{bucket, alice}, []*Grant{aliceRead}),
+		},
+		{
+			name:                      "added",
+			old:                       snapshot([]*Resource{bucket, alice}, []*Grant{aliceRead}),
+			current:                   snapshot([]*Resource{bucket, database, alice, bob, carol}, []*Grant{aliceRead, aliceAdmin, bobAdmin, carolRead}),
+			opts:                      Options{InternalDomains: []string{"@Example.com"}},
+			wantAddedResources:        []string{"r2"},
+			wantAddedPrincipals:       []string{"u2", "u3"},
+			wantAddedGrants:           []string{"g2", "g3", "g4"},
+			wantNewAdminGrants:        []string{"g2", "g3"},
+			wantNewExternalPrincipals: []string{"u2"},
+		},
+		{
+			name:                "no internal domains",
+			old:                 snapshot(nil, nil),
+			current:             snapshot([]*Resource{bob}, nil),
+			wantAddedPrincipals: []string{"u2"},
+		},
+		{
+			name:                  "removed",
+			old:                   snapshot([]*Resource{bucket, database, alice, bob}, []*Grant{aliceRead, bobAdmin}),
+			current:               snapshot([]*Resource{bucket, alice}, []*Grant{aliceRead}),
+			wantRemovedResources:  []string{"r2"},
+			wantRemovedPrincipals: []string{"u2"},
+			wantRemovedGrants:     []string{"g3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Compare(tt.old, tt.current, tt.opts)
+			checks := []struct {
+				field string
+				got   []string
+				want  []string
+			}{
+				{"AddedResources", resourceIDs(d.AddedResources), tt.wantAddedResources},
+				{"RemovedResources", resourceIDs(d.RemovedResources), tt.wantRemovedResources},
+				{"AddedPrincipals", resourceIDs(d.AddedPrincipals), tt.wantAddedPrincipals},
+				{"RemovedPrincipals", resourceIDs(d.RemovedPrincipals), tt.wantRemovedPrincipals},
+				{"AddedGrants", grantIDs(d.AddedGrants), tt.wantAddedGrants},
+				{"RemovedGrants", grantIDs(d.RemovedGrants), tt.wantRemovedGrants},
+				{"NewAdminGrants", grantIDs(d.NewAdminGrants), tt.wantNewAdminGrants},
+				{"NewExternalPrincipals", resourceIDs(d.NewExternalPrincipals), tt.wantNewExternalPrincipals},
+			}
+			for _, c := range checks {
+				if !slices.Equal(c.got, c.want) {
+					t.Errorf("%s = %v, want %v", c.field, c.got, c.want)
+				}
+			}
+
+			wantEmpty := len(tt.wantAddedResources) == 0 && len(tt.wantRemovedResources) == 0 &&
+				len(tt.wantAddedPrincipals) == 0 && len(tt.wantRemovedPrincipals) == 0 &&
+				len(tt.wantAddedGrants) == 0 && len(tt.wantRemovedGrants) == 0
+			if d.Empty() != wantEmpty {
+				t.Errorf("Empty() = %v, want %v", d.Empty(), wantEmpty)
+			}
+		})
+	}
+}